@@ -0,0 +1,89 @@
+package gormadapter
+
+import (
+	"context"
+	"fmt"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"gorm.io/gorm"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/adapter/sqladapter"
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+// Adapter stores the policy in the database of a GORM DB, in the table layout
+// of sqladapter, so the rules live next to the data of the service.
+type Adapter struct {
+	*sqladapter.Adapter
+
+	db *gorm.DB
+}
+
+// NewAdapter create an adapter on the database of db. When db is a
+// transaction, such as the tx of db.Transaction, the adapter reads and writes
+// through it.
+func NewAdapter(db *gorm.DB, opts ...sqladapter.Option) (*Adapter, error) {
+	dialect, err := dialectOf(db)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	a, err := sqladapter.NewAdapter(sqlDB, dialect, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if pool := connPool(db); isTx(pool) {
+		a = a.WithTx(pool)
+	}
+	return &Adapter{Adapter: a, db: db}, nil
+}
+
+func dialectOf(db *gorm.DB) (sqladapter.Dialect, error) {
+	switch name := db.Dialector.Name(); name {
+	case "sqlite", "sqlite3":
+		return sqladapter.SQLite, nil
+	case "mysql":
+		return sqladapter.MySQL, nil
+	case "postgres":
+		return sqladapter.Postgres, nil
+	default:
+		return "", fmt.Errorf("gormadapter: unsupported dialect %q", name)
+	}
+}
+
+func connPool(db *gorm.DB) gorm.ConnPool {
+	if db.Statement != nil && db.Statement.ConnPool != nil {
+		return db.Statement.ConnPool
+	}
+	return db.ConnPool
+}
+
+func isTx(pool gorm.ConnPool) bool {
+	_, ok := pool.(gorm.TxCommitter)
+	return ok
+}
+
+// Transaction runs fn in a database transaction together with a policy
+// transaction on the enforcer. The policy changes made by fn are stored in
+// the same database transaction, and applied to the enforcer once it
+// committed: e.g. creating a user and granting its role succeed or fail
+// together.
+func (a *Adapter) Transaction(ctx context.Context, enforcer *casbinV2.SyncedEnforcer, fn func(tx *gorm.DB, ptx *policy.Tx) error, opts ...policy.TxOption) (policy.Changeset, error) {
+	ptx := policy.Begin(enforcer, opts...)
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx, ptx); err != nil {
+			return err
+		}
+		_, err := ptx.Stage(a.Adapter.WithTx(connPool(tx)))
+		return err
+	})
+	if err != nil {
+		ptx.Rollback()
+		return nil, err
+	}
+	return ptx.Commit()
+}
@@ -0,0 +1,130 @@
+package gormadapter
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+const rbacModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch(r.obj, p.obj) && r.act == p.act
+`
+
+// User stands for the domain data of a service.
+type User struct {
+	ID   uint
+	Name string `gorm:"uniqueIndex"`
+}
+
+func newDB(t *testing.T) (*gorm.DB, *Adapter, *casbinV2.SyncedEnforcer) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "data.db")), &gorm.Config{Logger: logger.Discard})
+	assert.Nil(t, err)
+	assert.Nil(t, db.AutoMigrate(&User{}))
+
+	a, err := NewAdapter(db)
+	assert.Nil(t, err)
+	assert.Nil(t, a.Migrate(context.Background()))
+	assert.Nil(t, a.AddPolicy("p", "p", []string{"admin", "/api/*", "GET"}))
+
+	m, err := model.NewModelFromString(rbacModel)
+	assert.Nil(t, err)
+	enforcer, err := casbinV2.NewSyncedEnforcer(m, a)
+	assert.Nil(t, err)
+	return db, a, enforcer
+}
+
+func countUsers(t *testing.T, db *gorm.DB) int64 {
+	var n int64
+	assert.Nil(t, db.Model(&User{}).Count(&n).Error)
+	return n
+}
+
+func TestTransaction(t *testing.T) {
+	db, a, enforcer := newDB(t)
+	ctx := context.Background()
+
+	createAdmin := func(name string) func(tx *gorm.DB, ptx *policy.Tx) error {
+		return func(tx *gorm.DB, ptx *policy.Tx) error {
+			if err := tx.Create(&User{Name: name}).Error; err != nil {
+				return err
+			}
+			ptx.Add("g", name, "admin")
+			return nil
+		}
+	}
+
+	changes, err := a.Transaction(ctx, enforcer, createAdmin("alice"))
+	assert.Nil(t, err)
+	added, _ := changes.Counts()
+	assert.Equal(t, 1, added)
+	allowed, _ := enforcer.Enforce("alice", "/api/users", "GET")
+	assert.True(t, allowed)
+	assert.Equal(t, int64(1), countUsers(t, db))
+
+	// the user already exists, the grant is not stored either
+	_, err = a.Transaction(ctx, enforcer, func(tx *gorm.DB, ptx *policy.Tx) error {
+		ptx.Add("g", "bob", "admin")
+		return tx.Create(&User{Name: "alice"}).Error
+	})
+	assert.NotNil(t, err)
+	has, _ := enforcer.HasGroupingPolicy("bob", "admin")
+	assert.False(t, has)
+
+	// a failing validation rolls the user back
+	_, err = a.Transaction(ctx, enforcer, createAdmin("carol"), policy.WithValidator(func(candidate *casbinV2.Enforcer) error {
+		return errors.New("carol may not be admin")
+	}))
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(1), countUsers(t, db))
+	has, _ = enforcer.HasGroupingPolicy("carol", "admin")
+	assert.False(t, has)
+
+	// the stored policy matches the in-memory policy
+	assert.Nil(t, enforcer.LoadPolicy())
+	groupings, _ := enforcer.GetGroupingPolicy()
+	assert.Equal(t, [][]string{{"alice", "admin"}}, groupings)
+}
+
+func TestNewAdapterInTransaction(t *testing.T) {
+	db, _, enforcer := newDB(t)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		a, err := NewAdapter(tx)
+		if err != nil {
+			return err
+		}
+		if err = a.AddPolicy("g", "g", []string{"dave", "admin"}); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	assert.EqualError(t, err, "abort")
+
+	assert.Nil(t, enforcer.LoadPolicy())
+	groupings, _ := enforcer.GetGroupingPolicy()
+	assert.Empty(t, groupings)
+}
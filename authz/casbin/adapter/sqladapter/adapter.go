@@ -0,0 +1,479 @@
+package sqladapter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+const (
+	defaultTableName = "casbin_rule"
+
+	// maxValues is the number of value columns, v0 to v5.
+	maxValues = 6
+)
+
+var (
+	ErrInvalidTableName = errors.New("sqladapter: invalid table name")
+	ErrRuleTooLong      = fmt.Errorf("sqladapter: rules have at most %d values", maxValues)
+	ErrInvalidFilter    = errors.New("sqladapter: invalid filter type")
+)
+
+var (
+	_ persist.FilteredAdapter  = (*Adapter)(nil)
+	_ persist.BatchAdapter     = (*Adapter)(nil)
+	_ persist.UpdatableAdapter = (*Adapter)(nil)
+
+	tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Dialect is the SQL dialect of the database.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	MySQL    Dialect = "mysql"
+	Postgres Dialect = "postgres"
+)
+
+// bind returns the placeholder of the i-th argument, counted from 1.
+func (d Dialect) bind(i int) string {
+	if d == Postgres {
+		return "$" + strconv.Itoa(i)
+	}
+	return "?"
+}
+
+func (d Dialect) idColumn() string {
+	switch d {
+	case MySQL:
+		return "id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY"
+	case Postgres:
+		return "id BIGSERIAL PRIMARY KEY"
+	default:
+		return "id INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+}
+
+// Option is an adapter option.
+type Option func(*Adapter)
+
+// WithTableName store the rules in the table, "casbin_rule" by default
+func WithTableName(name string) Option {
+	return func(a *Adapter) {
+		a.table = name
+	}
+}
+
+// Adapter stores the policy in a table of a database/sql database, one rule
+// per row with its ptype and up to six values. Create the table with Migrate,
+// or with the statements of Migrations in your own migration tool.
+type Adapter struct {
+	db       *sql.DB
+	tx       Querier
+	dialect  Dialect
+	table    string
+	filtered bool
+}
+
+// NewAdapter create an adapter on the database.
+func NewAdapter(db *sql.DB, dialect Dialect, opts ...Option) (*Adapter, error) {
+	a := &Adapter{
+		db:      db,
+		dialect: dialect,
+		table:   defaultTableName,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	switch dialect {
+	case SQLite, MySQL, Postgres:
+	default:
+		return nil, fmt.Errorf("sqladapter: unsupported dialect %q", dialect)
+	}
+	if !tableNamePattern.MatchString(a.table) {
+		return nil, ErrInvalidTableName
+	}
+	return a, nil
+}
+
+// Filter selects rules by ptype and values. Empty fields match anything, a
+// rule matches when each set field contains its value.
+type Filter struct {
+	PType []string
+	V0    []string
+	V1    []string
+	V2    []string
+	V3    []string
+	V4    []string
+	V5    []string
+}
+
+func (f Filter) fields() [maxValues + 1][]string {
+	return [maxValues + 1][]string{f.PType, f.V0, f.V1, f.V2, f.V3, f.V4, f.V5}
+}
+
+// DomainFilter selects the rules of a domain for the models with
+// "p = sub, dom, obj, act" and "g = _, _, _".
+func DomainFilter(domain string) []Filter {
+	return []Filter{
+		{PType: []string{"p"}, V1: []string{domain}},
+		{PType: []string{"g"}, V2: []string{domain}},
+	}
+}
+
+var columns = [maxValues + 1]string{"ptype", "v0", "v1", "v2", "v3", "v4", "v5"}
+
+// row returns the column values of a rule.
+func row(ptype string, rule []string) ([]interface{}, error) {
+	if len(rule) > maxValues {
+		return nil, ErrRuleTooLong
+	}
+	values := make([]interface{}, maxValues+1)
+	values[0] = ptype
+	for i := 1; i <= maxValues; i++ {
+		values[i] = ""
+		if i <= len(rule) {
+			values[i] = rule[i-1]
+		}
+	}
+	return values, nil
+}
+
+// Querier runs the statements of the adapter, such as a *sql.DB, a *sql.Tx
+// or the generated Tx of Ent with the sql/execquery feature.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// WithTx returns a copy of the adapter reading and writing through tx, so
+// rules are committed together with the other data of the transaction. Pass
+// it to policy.Tx.Stage before committing, then commit the policy.Tx.
+func (a *Adapter) WithTx(tx Querier) *Adapter {
+	bound := *a
+	bound.tx = tx
+	return &bound
+}
+
+func (a *Adapter) conn() Querier {
+	if a.tx != nil {
+		return a.tx
+	}
+	return a.db
+}
+
+// inTx runs fn in a transaction, or in the transaction the adapter is bound to.
+func (a *Adapter) inTx(ctx context.Context, fn func(q Querier) error) error {
+	if a.tx != nil {
+		return fn(a.tx)
+	}
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (a *Adapter) load(ctx context.Context, m model.Model, where string, args []interface{}) error {
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY id", strings.Join(columns[:], ", "), a.table, where)
+	rules, err := a.query(ctx, a.conn(), query, args)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err = persist.LoadPolicyArray(rule, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// query returns the rules of the rows, ptype first.
+func (a *Adapter) query(ctx context.Context, q Querier, query string, args []interface{}) ([][]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules [][]string
+	for rows.Next() {
+		var values [maxValues + 1]string
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		// trailing empty values are padding
+		n := len(values)
+		for n > 1 && values[n-1] == "" {
+			n--
+		}
+		rules = append(rules, values[:n:n])
+	}
+	return rules, rows.Err()
+}
+
+// LoadPolicy loads all the rules.
+func (a *Adapter) LoadPolicy(m model.Model) error {
+	if err := a.load(context.Background(), m, "", nil); err != nil {
+		return err
+	}
+	a.filtered = false
+	return nil
+}
+
+// LoadFilteredPolicy loads the rules matching the filter, a Filter or a
+// []Filter loading the rules matching any of them, e.g. DomainFilter.
+func (a *Adapter) LoadFilteredPolicy(m model.Model, filter interface{}) error {
+	var filters []Filter
+	switch f := filter.(type) {
+	case nil:
+		return a.LoadPolicy(m)
+	case Filter:
+		filters = []Filter{f}
+	case *Filter:
+		filters = []Filter{*f}
+	case []Filter:
+		filters = f
+	default:
+		return ErrInvalidFilter
+	}
+
+	where, args := a.filterClause(filters)
+	if err := a.load(context.Background(), m, where, args); err != nil {
+		return err
+	}
+	a.filtered = true
+	return nil
+}
+
+func (a *Adapter) filterClause(filters []Filter) (string, []interface{}) {
+	var (
+		disjunction []string
+		args        []interface{}
+	)
+	for _, f := range filters {
+		var conjunction []string
+		for i, values := range f.fields() {
+			if len(values) == 0 {
+				continue
+			}
+			binds := make([]string, len(values))
+			for j, v := range values {
+				args = append(args, v)
+				binds[j] = a.dialect.bind(len(args))
+			}
+			conjunction = append(conjunction, fmt.Sprintf("%s IN (%s)", columns[i], strings.Join(binds, ", ")))
+		}
+		if len(conjunction) == 0 {
+			// an empty filter matches every rule
+			return "", nil
+		}
+		disjunction = append(disjunction, "("+strings.Join(conjunction, " AND ")+")")
+	}
+	if len(disjunction) == 0 {
+		return " WHERE 1 = 0", nil
+	}
+	return " WHERE " + strings.Join(disjunction, " OR "), args
+}
+
+// IsFiltered reports whether the last load was filtered.
+func (a *Adapter) IsFiltered() bool {
+	return a.filtered
+}
+
+// SavePolicy replaces the stored rules with the rules of the model.
+func (a *Adapter) SavePolicy(m model.Model) error {
+	return a.inTx(context.Background(), func(q Querier) error {
+		if _, err := q.ExecContext(context.Background(), "DELETE FROM "+a.table); err != nil {
+			return err
+		}
+		for _, sec := range []string{"p", "g"} {
+			for ptype, ast := range m[sec] {
+				if err := a.insert(context.Background(), q, ptype, ast.Policy); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (a *Adapter) insert(ctx context.Context, q Querier, ptype string, rules [][]string) error {
+	binds := make([]string, len(columns))
+	for i := range binds {
+		binds[i] = a.dialect.bind(i + 1)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", a.table, strings.Join(columns[:], ", "), strings.Join(binds, ", "))
+	for _, rule := range rules {
+		values, err := row(ptype, rule)
+		if err != nil {
+			return err
+		}
+		if _, err = q.ExecContext(ctx, query, values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ruleClause matches the row of a rule, the arguments numbered from offset+1.
+func (a *Adapter) ruleClause(ptype string, rule []string, offset int) (string, []interface{}, error) {
+	values, err := row(ptype, rule)
+	if err != nil {
+		return "", nil, err
+	}
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		conditions[i] = column + " = " + a.dialect.bind(offset+i+1)
+	}
+	return strings.Join(conditions, " AND "), values, nil
+}
+
+func (a *Adapter) remove(ctx context.Context, q Querier, ptype string, rules [][]string) error {
+	for _, rule := range rules {
+		where, args, err := a.ruleClause(ptype, rule, 0)
+		if err != nil {
+			return err
+		}
+		if _, err = q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", a.table, where), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddPolicy adds a rule.
+func (a *Adapter) AddPolicy(_ string, ptype string, rule []string) error {
+	return a.insert(context.Background(), a.conn(), ptype, [][]string{rule})
+}
+
+// AddPolicies adds the rules in a transaction.
+func (a *Adapter) AddPolicies(_ string, ptype string, rules [][]string) error {
+	return a.inTx(context.Background(), func(q Querier) error {
+		return a.insert(context.Background(), q, ptype, rules)
+	})
+}
+
+// RemovePolicy removes a rule.
+func (a *Adapter) RemovePolicy(_ string, ptype string, rule []string) error {
+	return a.remove(context.Background(), a.conn(), ptype, [][]string{rule})
+}
+
+// RemovePolicies removes the rules in a transaction.
+func (a *Adapter) RemovePolicies(_ string, ptype string, rules [][]string) error {
+	return a.inTx(context.Background(), func(q Querier) error {
+		return a.remove(context.Background(), q, ptype, rules)
+	})
+}
+
+// fieldClause matches the rows of ptype with the field values from
+// fieldIndex, empty values matching anything.
+func (a *Adapter) fieldClause(ptype string, fieldIndex int, fieldValues []string) (string, []interface{}, error) {
+	if fieldIndex < 0 || fieldIndex+len(fieldValues) > maxValues {
+		return "", nil, ErrRuleTooLong
+	}
+	conditions := []string{"ptype = " + a.dialect.bind(1)}
+	args := []interface{}{ptype}
+	for i, v := range fieldValues {
+		if v == "" {
+			continue
+		}
+		args = append(args, v)
+		conditions = append(conditions, columns[fieldIndex+i+1]+" = "+a.dialect.bind(len(args)))
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// RemoveFilteredPolicy removes the rules matching the field values.
+func (a *Adapter) RemoveFilteredPolicy(_ string, ptype string, fieldIndex int, fieldValues ...string) error {
+	where, args, err := a.fieldClause(ptype, fieldIndex, fieldValues)
+	if err != nil {
+		return err
+	}
+	_, err = a.conn().ExecContext(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE %s", a.table, where), args...)
+	return err
+}
+
+func (a *Adapter) update(ctx context.Context, q Querier, ptype string, oldRule, newRule []string) error {
+	values, err := row(ptype, newRule)
+	if err != nil {
+		return err
+	}
+	sets := make([]string, len(columns))
+	for i, column := range columns {
+		sets[i] = column + " = " + a.dialect.bind(i+1)
+	}
+	where, args, err := a.ruleClause(ptype, oldRule, len(columns))
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", a.table, strings.Join(sets, ", "), where)
+	_, err = q.ExecContext(ctx, query, append(values, args...)...)
+	return err
+}
+
+// UpdatePolicy replaces a rule.
+func (a *Adapter) UpdatePolicy(_ string, ptype string, oldRule, newRule []string) error {
+	return a.update(context.Background(), a.conn(), ptype, oldRule, newRule)
+}
+
+// UpdatePolicies replaces the rules in a transaction.
+func (a *Adapter) UpdatePolicies(_ string, ptype string, oldRules, newRules [][]string) error {
+	if len(oldRules) != len(newRules) {
+		return fmt.Errorf("sqladapter: %d old rules for %d new rules", len(oldRules), len(newRules))
+	}
+	return a.inTx(context.Background(), func(q Querier) error {
+		for i := range oldRules {
+			if err := a.update(context.Background(), q, ptype, oldRules[i], newRules[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateFilteredPolicies replaces the rules matching the field values with
+// the new rules in a transaction, returning the replaced rules.
+func (a *Adapter) UpdateFilteredPolicies(_ string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	where, args, err := a.fieldClause(ptype, fieldIndex, fieldValues)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldRules [][]string
+	err = a.inTx(context.Background(), func(q Querier) error {
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY id", strings.Join(columns[:], ", "), a.table, where)
+		rules, err := a.query(context.Background(), q, query, args)
+		if err != nil {
+			return err
+		}
+		if _, err = q.ExecContext(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE %s", a.table, where), args...); err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			oldRules = append(oldRules, rule[1:])
+		}
+		return a.insert(context.Background(), q, ptype, newRules)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return oldRules, nil
+}
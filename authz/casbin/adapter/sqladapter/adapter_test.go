@@ -0,0 +1,175 @@
+package sqladapter
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+)
+
+const domainModel = `
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && keyMatch(r.obj, p.obj) && r.act == p.act
+`
+
+func newAdapter(t *testing.T) *Adapter {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "casbin.db"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	a, err := NewAdapter(db, SQLite)
+	assert.Nil(t, err)
+	assert.Nil(t, a.Migrate(context.Background()))
+	return a
+}
+
+func newEnforcer(t *testing.T, a *Adapter) *casbinV2.Enforcer {
+	m, err := model.NewModelFromString(domainModel)
+	assert.Nil(t, err)
+	e, err := casbinV2.NewEnforcer(m, a)
+	assert.Nil(t, err)
+	return e
+}
+
+func TestMigrate(t *testing.T) {
+	a := newAdapter(t)
+	version, err := a.SchemaVersion(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, len(Migrations(SQLite, defaultTableName)), version)
+
+	// applied migrations are skipped
+	assert.Nil(t, a.Migrate(context.Background()))
+
+	_, err = NewAdapter(a.db, SQLite, WithTableName("rules; DROP TABLE users"))
+	assert.Equal(t, ErrInvalidTableName, err)
+	_, err = NewAdapter(a.db, "oracle")
+	assert.NotNil(t, err)
+}
+
+func TestAdapter(t *testing.T) {
+	a := newAdapter(t)
+	e := newEnforcer(t, a)
+
+	_, err := e.AddPolicy("admin", "acme", "/api/*", "GET")
+	assert.Nil(t, err)
+	_, err = e.AddPolicies([][]string{{"admin", "globex", "/api/*", "GET"}, {"viewer", "acme", "/reports/*", "GET"}})
+	assert.Nil(t, err)
+	_, err = e.AddGroupingPolicies([][]string{{"alice", "admin", "acme"}, {"bob", "admin", "globex"}, {"carol", "viewer", "acme"}})
+	assert.Nil(t, err)
+	_, err = e.UpdatePolicy([]string{"viewer", "acme", "/reports/*", "GET"}, []string{"viewer", "acme", "/audit/*", "GET"})
+	assert.Nil(t, err)
+	_, err = e.RemoveGroupingPolicy("carol", "viewer", "acme")
+	assert.Nil(t, err)
+	_, err = e.RemoveFilteredPolicy(1, "globex")
+	assert.Nil(t, err)
+
+	reloaded := newEnforcer(t, a)
+	assert.False(t, a.IsFiltered())
+	policies, _ := reloaded.GetPolicy()
+	assert.Equal(t, [][]string{{"admin", "acme", "/api/*", "GET"}, {"viewer", "acme", "/audit/*", "GET"}}, policies)
+	groupings, _ := reloaded.GetGroupingPolicy()
+	assert.Equal(t, [][]string{{"alice", "admin", "acme"}, {"bob", "admin", "globex"}}, groupings)
+
+	allowed, _ := reloaded.Enforce("alice", "acme", "/api/users", "GET")
+	assert.True(t, allowed)
+
+	// saving replaces the rows
+	_, err = reloaded.RemoveGroupingPolicy("bob", "admin", "globex")
+	assert.Nil(t, err)
+	reloaded.GetModel()["p"]["p"].Policy = [][]string{{"admin", "acme", "/api/*", "*"}}
+	assert.Nil(t, reloaded.SavePolicy())
+	assert.Nil(t, e.LoadPolicy())
+	policies, _ = e.GetPolicy()
+	assert.Equal(t, [][]string{{"admin", "acme", "/api/*", "*"}}, policies)
+	groupings, _ = e.GetGroupingPolicy()
+	assert.Equal(t, [][]string{{"alice", "admin", "acme"}}, groupings)
+
+	_, err = e.AddPolicy("a", "b", "c", "d", "e", "f", "g")
+	assert.Equal(t, ErrRuleTooLong, err)
+}
+
+func TestLoadFilteredPolicy(t *testing.T) {
+	a := newAdapter(t)
+	e := newEnforcer(t, a)
+	_, _ = e.AddPolicies([][]string{{"admin", "acme", "/api/*", "GET"}, {"admin", "globex", "/api/*", "GET"}})
+	_, _ = e.AddGroupingPolicies([][]string{{"alice", "admin", "acme"}, {"bob", "admin", "globex"}})
+
+	tenant := newEnforcer(t, a)
+	assert.Nil(t, tenant.LoadFilteredPolicy(DomainFilter("acme")))
+	assert.True(t, a.IsFiltered())
+	policies, _ := tenant.GetPolicy()
+	assert.Equal(t, [][]string{{"admin", "acme", "/api/*", "GET"}}, policies)
+	groupings, _ := tenant.GetGroupingPolicy()
+	assert.Equal(t, [][]string{{"alice", "admin", "acme"}}, groupings)
+	allowed, _ := tenant.Enforce("alice", "acme", "/api/users", "GET")
+	assert.True(t, allowed)
+
+	assert.Nil(t, tenant.LoadFilteredPolicy(&Filter{PType: []string{"g"}, V0: []string{"alice", "bob"}}))
+	policies, _ = tenant.GetPolicy()
+	assert.Empty(t, policies)
+	groupings, _ = tenant.GetGroupingPolicy()
+	assert.Len(t, groupings, 2)
+
+	assert.Nil(t, tenant.LoadFilteredPolicy([]Filter{}))
+	groupings, _ = tenant.GetGroupingPolicy()
+	assert.Empty(t, groupings)
+
+	assert.Equal(t, ErrInvalidFilter, tenant.LoadFilteredPolicy("p, admin"))
+}
+
+func TestUpdateFilteredPolicies(t *testing.T) {
+	a := newAdapter(t)
+	assert.Nil(t, a.AddPolicies("p", "p", [][]string{{"admin", "acme", "/api/*", "GET"}, {"admin", "acme", "/api/*", "POST"}, {"admin", "globex", "/api/*", "GET"}}))
+
+	old, err := a.UpdateFilteredPolicies("p", "p", [][]string{{"admin", "acme", "/api/*", "*"}}, 1, "acme")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"admin", "acme", "/api/*", "GET"}, {"admin", "acme", "/api/*", "POST"}}, old)
+
+	assert.Nil(t, a.UpdatePolicies("p", "p", [][]string{{"admin", "globex", "/api/*", "GET"}}, [][]string{{"admin", "globex", "/api/*", "*"}}))
+	assert.Nil(t, a.RemovePolicies("p", "p", [][]string{{"admin", "acme", "/api/*", "*"}}))
+
+	e := newEnforcer(t, a)
+	policies, _ := e.GetPolicy()
+	assert.Equal(t, [][]string{{"admin", "globex", "/api/*", "*"}}, policies)
+}
+
+func TestWithTx(t *testing.T) {
+	a := newAdapter(t)
+
+	tx, err := a.db.Begin()
+	assert.Nil(t, err)
+	bound := a.WithTx(tx)
+	assert.Nil(t, bound.AddPolicies("p", "p", [][]string{{"admin", "acme", "/api/*", "GET"}}))
+	assert.Nil(t, bound.AddPolicy("g", "g", []string{"alice", "admin", "acme"}))
+	assert.Nil(t, tx.Rollback())
+
+	e := newEnforcer(t, a)
+	policies, _ := e.GetPolicy()
+	assert.Empty(t, policies)
+
+	tx, err = a.db.Begin()
+	assert.Nil(t, err)
+	assert.Nil(t, a.WithTx(tx).AddPolicy("p", "p", []string{"admin", "acme", "/api/*", "GET"}))
+	assert.Nil(t, tx.Commit())
+	assert.Nil(t, e.LoadPolicy())
+	policies, _ = e.GetPolicy()
+	assert.Len(t, policies, 1)
+}
@@ -0,0 +1,91 @@
+package sqladapter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Migration is a schema version of the rule table.
+type Migration struct {
+	Version    int
+	Statements []string
+}
+
+// Migrations returns the schema migrations of the rule table, oldest first,
+// for services applying them with their own migration tool.
+func Migrations(dialect Dialect, table string) []Migration {
+	values := ""
+	for _, column := range columns[1:] {
+		values += fmt.Sprintf(",\n\t%s VARCHAR(255) NOT NULL DEFAULT ''", column)
+	}
+	return []Migration{
+		{
+			Version: 1,
+			Statements: []string{
+				fmt.Sprintf("CREATE TABLE %s (\n\t%s,\n\tptype VARCHAR(100) NOT NULL%s\n)", table, dialect.idColumn(), values),
+				// enforcers load by ptype and filter by subject or domain
+				fmt.Sprintf("CREATE INDEX idx_%s_ptype_v0_v1 ON %s (ptype, v0, v1)", table, table),
+				fmt.Sprintf("CREATE INDEX idx_%s_ptype_v2 ON %s (ptype, v2)", table, table),
+			},
+		},
+	}
+}
+
+func (a *Adapter) migrationsTable() string {
+	return a.table + "_migrations"
+}
+
+// SchemaVersion returns the applied schema version of the rule table, 0 when
+// the table has not been migrated by Migrate.
+func (a *Adapter) SchemaVersion(ctx context.Context) (int, error) {
+	if err := a.createMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+	rows, err := a.conn().QueryContext(ctx, "SELECT MAX(version) FROM "+a.migrationsTable())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var version sql.NullInt64
+	if rows.Next() {
+		if err = rows.Scan(&version); err != nil {
+			return 0, err
+		}
+	}
+	return int(version.Int64), rows.Err()
+}
+
+func (a *Adapter) createMigrationsTable(ctx context.Context) error {
+	_, err := a.conn().ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL PRIMARY KEY)", a.migrationsTable()))
+	return err
+}
+
+// Migrate applies the pending migrations of the rule table, each in a
+// transaction, recording the versions in the "<table>_migrations" table.
+func (a *Adapter) Migrate(ctx context.Context) error {
+	current, err := a.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range Migrations(a.dialect, a.table) {
+		if m.Version <= current {
+			continue
+		}
+		err = a.inTx(ctx, func(q Querier) error {
+			for _, statement := range m.Statements {
+				if _, err := q.ExecContext(ctx, statement); err != nil {
+					return err
+				}
+			}
+			_, err := q.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version) VALUES (%s)", a.migrationsTable(), a.dialect.bind(1)), m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("sqladapter: migration %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,485 @@
+package yamladapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"gopkg.in/yaml.v3"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+// errNotImplemented is the error casbin ignores for the auto-save methods,
+// the file is rewritten by SavePolicy.
+var errNotImplemented = errors.New("not implemented")
+
+// ErrIncludedRule is returned by SavePolicy when a rule of an included file
+// was removed, included files are read-only.
+var ErrIncludedRule = errors.New("yamladapter: included rules cannot be removed")
+
+var (
+	_ persist.Adapter      = (*Adapter)(nil)
+	_ persist.BatchAdapter = (*Adapter)(nil)
+)
+
+// Document is the content of a policy file:
+//
+//	# permissions and roles are the "p" and "g" rules
+//	include: [base.yaml]
+//	permissions:
+//	  - [admin, /admin.v1.AdminService/*, "*"]
+//	roles:
+//	  - [cathy, admin]
+//	# rules of domain models, the domain is inserted at the "dom" field of
+//	# "p" and as the third field of "g"
+//	domains:
+//	  acme:
+//	    permissions:
+//	      - [admin, /api/*, GET]
+//	    roles:
+//	      - [alice, admin]
+//	# rules of the other policy types
+//	rules:
+//	  g2:
+//	    - [/api/users, api]
+type Document struct {
+	Include     []string              `yaml:"include,omitempty" json:"include,omitempty"`
+	Permissions [][]string            `yaml:"permissions,omitempty" json:"permissions,omitempty"`
+	Roles       [][]string            `yaml:"roles,omitempty" json:"roles,omitempty"`
+	Domains     map[string]*Domain    `yaml:"domains,omitempty" json:"domains,omitempty"`
+	Rules       map[string][][]string `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// Domain holds the rules of a domain, without the domain field.
+type Domain struct {
+	Permissions [][]string `yaml:"permissions,omitempty" json:"permissions,omitempty"`
+	Roles       [][]string `yaml:"roles,omitempty" json:"roles,omitempty"`
+}
+
+// Adapter reads and writes the policy in a YAML file, or a JSON file when its
+// extension is ".json". Included files are read-only: SavePolicy writes the
+// rules which are not included to the file, keeping the comments of the YAML
+// sections and rules which are still there.
+type Adapter struct {
+	path string
+}
+
+// NewAdapter create an adapter on the policy file.
+func NewAdapter(path string) *Adapter {
+	return &Adapter{path: path}
+}
+
+func isJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// readDocument parses a file, a missing file being empty.
+func readDocument(path string) (*Document, *yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Document{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc := &Document{}
+	if isJSON(path) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(doc); err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("yamladapter: %s: %w", path, err)
+		}
+		return doc, nil, nil
+	}
+
+	node := &yaml.Node{}
+	if err = yaml.Unmarshal(data, node); err != nil {
+		return nil, nil, fmt.Errorf("yamladapter: %s: %w", path, err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("yamladapter: %s: %w", path, err)
+	}
+	return doc, node, nil
+}
+
+// readIncludes returns the rules of the files included by doc and their own
+// includes, paths being relative to the including file. When origins is not
+// nil, it maps the key of every rule to the file defining it.
+func readIncludes(m model.Model, path string, doc *Document, visiting map[string]bool, origins map[string]string) (policy.Rules, error) {
+	rules := make(policy.Rules)
+	for _, include := range doc.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		abs, err := filepath.Abs(include)
+		if err != nil {
+			return nil, err
+		}
+		if visiting[abs] {
+			return nil, fmt.Errorf("yamladapter: include cycle at %s", include)
+		}
+		if _, err = os.Stat(include); err != nil {
+			return nil, err
+		}
+
+		included, _, err := readDocument(include)
+		if err != nil {
+			return nil, err
+		}
+		visiting[abs] = true
+		nested, err := readIncludes(m, include, included, visiting, origins)
+		delete(visiting, abs)
+		if err != nil {
+			return nil, err
+		}
+		own, err := expand(m, included)
+		if err != nil {
+			return nil, fmt.Errorf("yamladapter: %s: %w", include, err)
+		}
+		if origins != nil {
+			for ptype, ptypeRules := range own {
+				for _, rule := range ptypeRules {
+					origins[ruleKey(ptype, rule)] = include
+				}
+			}
+		}
+		merge(rules, nested)
+		merge(rules, own)
+	}
+	return rules, nil
+}
+
+func ruleKey(ptype string, rule []string) string {
+	return ptype + ", " + strings.Join(rule, ", ")
+}
+
+func merge(dst, src policy.Rules) {
+	for ptype, rules := range src {
+		dst[ptype] = append(dst[ptype], rules...)
+	}
+}
+
+// domainIndex returns the field of the domain in the rules of ptype.
+func domainIndex(m model.Model, sec, ptype string) (int, bool) {
+	ast, ok := m[sec][ptype]
+	if !ok {
+		return 0, false
+	}
+	if sec == "p" {
+		for i, token := range ast.Tokens {
+			if token == ptype+"_dom" {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	// role definitions with a third field, "g = _, _, _", end with the domain;
+	// the parameters of conditional ones, "g = _, _, (_, _)", are not tokens
+	return 2, len(ast.Tokens) >= 3
+}
+
+func insert(rule []string, i int, value string) []string {
+	if i > len(rule) {
+		i = len(rule)
+	}
+	result := make([]string, 0, len(rule)+1)
+	result = append(result, rule[:i]...)
+	result = append(result, value)
+	return append(result, rule[i:]...)
+}
+
+func without(rule []string, i int) []string {
+	result := make([]string, 0, len(rule)-1)
+	result = append(result, rule[:i]...)
+	return append(result, rule[i+1:]...)
+}
+
+// expand returns the rules of a document, domains inserted.
+func expand(m model.Model, doc *Document) (policy.Rules, error) {
+	rules := make(policy.Rules)
+	rules["p"] = append(rules["p"], doc.Permissions...)
+	rules["g"] = append(rules["g"], doc.Roles...)
+	for ptype, r := range doc.Rules {
+		rules[ptype] = append(rules[ptype], r...)
+	}
+
+	names := make([]string, 0, len(doc.Domains))
+	for name := range doc.Domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		domain := doc.Domains[name]
+		if domain == nil {
+			continue
+		}
+		for _, section := range []struct {
+			sec   string
+			rules [][]string
+		}{{"p", domain.Permissions}, {"g", domain.Roles}} {
+			if len(section.rules) == 0 {
+				continue
+			}
+			i, ok := domainIndex(m, section.sec, section.sec)
+			if !ok {
+				return nil, fmt.Errorf("domain %q: the model has no domain in %q", name, section.sec)
+			}
+			for _, rule := range section.rules {
+				rules[section.sec] = append(rules[section.sec], insert(rule, i, name))
+			}
+		}
+	}
+
+	for ptype, r := range rules {
+		if len(r) == 0 {
+			delete(rules, ptype)
+		}
+	}
+	return rules, nil
+}
+
+// LoadPolicy loads the rules of the file and of the files it includes.
+func (a *Adapter) LoadPolicy(m model.Model) error {
+	doc, _, err := readDocument(a.path)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(a.path)
+	if err != nil {
+		return err
+	}
+	rules, err := readIncludes(m, a.path, doc, map[string]bool{abs: true}, nil)
+	if err != nil {
+		return err
+	}
+	own, err := expand(m, doc)
+	if err != nil {
+		return fmt.Errorf("yamladapter: %s: %w", a.path, err)
+	}
+	merge(rules, own)
+
+	for _, ptype := range rules.PTypes() {
+		for _, rule := range rules[ptype] {
+			if err = persist.LoadPolicyArray(append([]string{ptype}, rule...), m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SavePolicy writes the rules of the model which are not included to the file.
+// It fails with ErrIncludedRule when an included rule is missing from the model.
+func (a *Adapter) SavePolicy(m model.Model) error {
+	existing, node, err := readDocument(a.path)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(a.path)
+	if err != nil {
+		return err
+	}
+	origins := make(map[string]string)
+	included, err := readIncludes(m, a.path, existing, map[string]bool{abs: true}, origins)
+	if err != nil {
+		return err
+	}
+
+	doc := &Document{Include: existing.Include}
+	rules := policy.FromModel(m)
+	for _, change := range policy.Diff(included, rules) {
+		if len(change.Removed) > 0 {
+			key := ruleKey(change.PType, change.Removed[0])
+			return fmt.Errorf("%w: %s is defined in include %s", ErrIncludedRule, key, origins[key])
+		}
+		for _, rule := range change.Added {
+			place(m, doc, change.Section, change.PType, rule)
+		}
+	}
+
+	var data []byte
+	if isJSON(a.path) {
+		if data, err = json.MarshalIndent(doc, "", "  "); err == nil {
+			data = append(data, '\n')
+		}
+	} else {
+		data, err = encodeYAML(doc, node)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFile(a.path, data)
+}
+
+// place adds a rule to its section of the document.
+func place(m model.Model, doc *Document, sec, ptype string, rule []string) {
+	if ptype == sec {
+		if i, ok := domainIndex(m, sec, ptype); ok && i < len(rule) {
+			if doc.Domains == nil {
+				doc.Domains = make(map[string]*Domain)
+			}
+			domain := doc.Domains[rule[i]]
+			if domain == nil {
+				domain = &Domain{}
+				doc.Domains[rule[i]] = domain
+			}
+			if sec == "p" {
+				domain.Permissions = append(domain.Permissions, without(rule, i))
+			} else {
+				domain.Roles = append(domain.Roles, without(rule, i))
+			}
+			return
+		}
+	}
+
+	switch ptype {
+	case "p":
+		doc.Permissions = append(doc.Permissions, rule)
+	case "g":
+		doc.Roles = append(doc.Roles, rule)
+	default:
+		if doc.Rules == nil {
+			doc.Rules = make(map[string][][]string)
+		}
+		doc.Rules[ptype] = append(doc.Rules[ptype], rule)
+	}
+}
+
+// encodeYAML encodes the document with rules on one line, keeping the
+// comments and styles of the previous content.
+func encodeYAML(doc *Document, previous *yaml.Node) ([]byte, error) {
+	content := &yaml.Node{}
+	if err := content.Encode(doc); err != nil {
+		return nil, err
+	}
+	flowRules(content)
+	node := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{content}}
+	if previous != nil {
+		copyLayout(node, previous)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flowRules writes the rules, sequences of a sequence, in flow style.
+func flowRules(node *yaml.Node) {
+	for _, child := range node.Content {
+		if node.Kind == yaml.SequenceNode && child.Kind == yaml.SequenceNode {
+			child.Style = yaml.FlowStyle
+			continue
+		}
+		flowRules(child)
+	}
+}
+
+// copyLayout copies the comments and styles of src to the matching nodes of
+// dst, keys of mappings and items of sequences matching by value.
+func copyLayout(dst, src *yaml.Node) {
+	dst.HeadComment, dst.LineComment, dst.FootComment = src.HeadComment, src.LineComment, src.FootComment
+	if dst.Kind == src.Kind {
+		dst.Style = src.Style
+	}
+
+	switch {
+	case dst.Kind == yaml.DocumentNode && src.Kind == yaml.DocumentNode:
+		if len(dst.Content) > 0 && len(src.Content) > 0 {
+			copyLayout(dst.Content[0], src.Content[0])
+		}
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			for j := 0; j+1 < len(src.Content); j += 2 {
+				if dst.Content[i].Value == src.Content[j].Value {
+					copyLayout(dst.Content[i], src.Content[j])
+					copyLayout(dst.Content[i+1], src.Content[j+1])
+					break
+				}
+			}
+		}
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		items := make(map[string]*yaml.Node, len(src.Content))
+		for _, item := range src.Content {
+			items[fingerprint(item)] = item
+		}
+		for _, item := range dst.Content {
+			if previous, ok := items[fingerprint(item)]; ok {
+				copyLayout(item, previous)
+			}
+		}
+	}
+}
+
+func fingerprint(node *yaml.Node) string {
+	if node.Kind != yaml.SequenceNode {
+		return node.Value
+	}
+	values := make([]string, len(node.Content))
+	for i, child := range node.Content {
+		values[i] = fingerprint(child)
+	}
+	return "[" + strings.Join(values, "\x00") + "]"
+}
+
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".policy-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if info, err := os.Stat(path); err == nil {
+		_ = f.Chmod(info.Mode())
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// AddPolicy is not supported, changes are written by SavePolicy.
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return errNotImplemented
+}
+
+// AddPolicies is not supported, changes are written by SavePolicy.
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	return errNotImplemented
+}
+
+// RemovePolicies is not supported, changes are written by SavePolicy.
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return errNotImplemented
+}
+
+// RemovePolicy is not supported, changes are written by SavePolicy.
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return errNotImplemented
+}
+
+// RemoveFilteredPolicy is not supported, changes are written by SavePolicy.
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return errNotImplemented
+}
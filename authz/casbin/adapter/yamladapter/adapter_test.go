@@ -0,0 +1,235 @@
+package yamladapter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+)
+
+const domainModel = `
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && keyMatch(r.obj, p.obj) && r.act == p.act
+`
+
+const basePolicy = `# shared by every service
+domains:
+  acme:
+    permissions:
+      - [viewer, /api/*, GET]
+`
+
+const mainPolicy = `# policy of the billing service
+include: [base.yaml]
+
+domains:
+  acme:
+    permissions:
+      # full access for the admins
+      - [admin, /api/*, "*"]
+      - [admin, /billing/*, POST] # temporary
+    roles:
+      - [alice, admin]
+  globex:
+    roles:
+      - [bob, viewer]
+rules:
+  g2:
+    - [/api/users, api]
+`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return dir
+}
+
+func newEnforcer(t *testing.T, path string) *casbinV2.Enforcer {
+	m, err := model.NewModelFromString(domainModel)
+	assert.Nil(t, err)
+	e, err := casbinV2.NewEnforcer(m, NewAdapter(path))
+	assert.Nil(t, err)
+	return e
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"base.yaml": basePolicy, "policy.yaml": mainPolicy})
+	e := newEnforcer(t, filepath.Join(dir, "policy.yaml"))
+
+	policies, _ := e.GetPolicy()
+	assert.Equal(t, [][]string{
+		{"viewer", "acme", "/api/*", "GET"},
+		{"admin", "acme", "/api/*", "*"},
+		{"admin", "acme", "/billing/*", "POST"},
+	}, policies)
+	groupings, _ := e.GetGroupingPolicy()
+	assert.Equal(t, [][]string{{"alice", "admin", "acme"}, {"bob", "viewer", "globex"}}, groupings)
+	g2, _ := e.GetNamedGroupingPolicy("g2")
+	assert.Equal(t, [][]string{{"/api/users", "api"}}, g2)
+
+	allowed, _ := e.Enforce("alice", "acme", "/billing/invoices", "POST")
+	assert.True(t, allowed)
+}
+
+func TestSavePolicy(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"base.yaml": basePolicy, "policy.yaml": mainPolicy})
+	path := filepath.Join(dir, "policy.yaml")
+	e := newEnforcer(t, path)
+
+	_, err := e.RemovePolicy("admin", "acme", "/billing/*", "POST")
+	assert.Nil(t, err)
+	_, err = e.AddGroupingPolicy("carol", "admin", "acme")
+	assert.Nil(t, err)
+	assert.Nil(t, e.SavePolicy())
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, `# policy of the billing service
+include: [base.yaml]
+domains:
+  acme:
+    permissions:
+      # full access for the admins
+      - [admin, /api/*, "*"]
+    roles:
+      - [alice, admin]
+      - [carol, admin]
+  globex:
+    roles:
+      - [bob, viewer]
+rules:
+  g2:
+    - [/api/users, api]
+`, string(data))
+
+	// the included rules are loaded once
+	reloaded := newEnforcer(t, path)
+	policies, _ := reloaded.GetPolicy()
+	assert.Equal(t, [][]string{{"viewer", "acme", "/api/*", "GET"}, {"admin", "acme", "/api/*", "*"}}, policies)
+
+	// the included rules cannot be removed
+	removed, err := reloaded.RemovePolicy("viewer", "acme", "/api/*", "GET")
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	err = reloaded.SavePolicy()
+	assert.ErrorIs(t, err, ErrIncludedRule)
+	assert.ErrorContains(t, err, "p, viewer, acme, /api/*, GET is defined in include "+filepath.Join(dir, "base.yaml"))
+	unchanged, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, data, unchanged)
+}
+
+func TestJSON(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.yaml":   basePolicy,
+		"policy.json": `{"include": ["base.yaml"], "domains": {"acme": {"roles": [["alice", "viewer"]]}}}`,
+	})
+	path := filepath.Join(dir, "policy.json")
+	e := newEnforcer(t, path)
+	allowed, _ := e.Enforce("alice", "acme", "/api/users", "GET")
+	assert.True(t, allowed)
+
+	_, err := e.AddPolicy("admin", "globex", "/api/*", "*")
+	assert.Nil(t, err)
+	assert.Nil(t, e.SavePolicy())
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"include": ["base.yaml"],
+		"domains": {
+			"acme": {"roles": [["alice", "viewer"]]},
+			"globex": {"permissions": [["admin", "/api/*", "*"]]}
+		}
+	}`, string(data))
+
+	reloaded := newEnforcer(t, path)
+	policies, _ := reloaded.GetPolicy()
+	assert.Len(t, policies, 2)
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.yaml":       "include: [b.yaml]\n",
+		"b.yaml":       "include: [a.yaml]\n",
+		"unknown.yaml": "permission:\n  - [admin, /api/*, GET]\n",
+		"missing.yaml": "include: [nowhere.yaml]\n",
+		"flat.yaml":    "domains:\n  acme:\n    roles:\n      - [alice, admin]\n",
+	})
+	m, _ := model.NewModelFromString(domainModel)
+
+	assert.ErrorContains(t, NewAdapter(filepath.Join(dir, "a.yaml")).LoadPolicy(m.Copy()), "include cycle")
+	assert.ErrorContains(t, NewAdapter(filepath.Join(dir, "unknown.yaml")).LoadPolicy(m.Copy()), "permission")
+	assert.NotNil(t, NewAdapter(filepath.Join(dir, "missing.yaml")).LoadPolicy(m.Copy()))
+
+	flat, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`)
+	assert.ErrorContains(t, NewAdapter(filepath.Join(dir, "flat.yaml")).LoadPolicy(flat), "no domain")
+}
+
+func TestConditionalRoles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"policy.yaml": "roles:\n  - [cathy, admin, _, _]\n"})
+	path := filepath.Join(dir, "policy.yaml")
+	m, err := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _, (_, _)
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`)
+	assert.Nil(t, err)
+	e, err := casbinV2.NewEnforcer(m, NewAdapter(path))
+	assert.Nil(t, err)
+
+	// auto-save is ignored, batches included
+	_, err = e.AddGroupingPolicies([][]string{{"alice", "oncall", "2024-05-01 08:00:00", "2024-05-01 16:00:00"}})
+	assert.Nil(t, err)
+	_, err = e.RemoveGroupingPolicies([][]string{{"cathy", "admin", "_", "_"}})
+	assert.Nil(t, err)
+	assert.Nil(t, e.SavePolicy())
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "roles:\n  - [alice, oncall, \"2024-05-01 08:00:00\", \"2024-05-01 16:00:00\"]\n", string(data))
+}
@@ -2,16 +2,21 @@ package casbin
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	casbinV2 "github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/rbac"
+	"github.com/casbin/govaluate"
 
 	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 
 	"github.com/tx7do/kratos-casbin/authz"
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
 )
 
 type contextKey string
@@ -47,6 +52,9 @@ var (
 	ErrEnforcerMissing            = errors.Forbidden(reason, "Enforcer is missing")
 	ErrSecurityParseFailed        = errors.Forbidden(reason, "Security Info fault")
 	ErrUnauthorized               = errors.Forbidden(reason, "Unauthorized Access")
+	ErrTenantMissing              = errors.Forbidden(reason, "Tenant is missing")
+	ErrOperationUnmapped          = errors.Forbidden(reason, "Operation is not mapped")
+	ErrPathNotCanonical           = errors.BadRequest("BAD_REQUEST", "Path is not canonical")
 )
 
 type Option func(*options)
@@ -60,6 +68,21 @@ type options struct {
 	policy                 persist.Adapter
 	watcher                persist.Watcher
 	enforcer               *casbinV2.SyncedEnforcer
+	tenants                *TenantRegistry
+	tenantResolver         TenantResolver
+	domainMatchingFunc     rbac.MatchingFunc
+	domainHierarchy        DomainHierarchy
+	decisionHook           DecisionHook
+	bypass                 []BypassFunc
+	operations             OperationCatalog
+
+	streamReauthorization         bool
+	streamReauthorizationInterval time.Duration
+
+	publishers    policy.Publishers
+	swap          *SwapEnforcer
+	temporalRoles []string
+	functions     map[string]govaluate.ExpressionFunction
 }
 
 // WithDomainSupport  enable domain support
@@ -76,7 +99,15 @@ func WithWatcher(watcher persist.Watcher) Option {
 	}
 }
 
-// WithAutoLoadPolicy enable policy auto load option
+// WithPublisher publish the policy changes applied by watcher-triggered reloads
+func WithPublisher(publishers ...policy.Publisher) Option {
+	return func(o *options) {
+		o.publishers = append(o.publishers, publishers...)
+	}
+}
+
+// WithAutoLoadPolicy enable policy auto load option, stopped on shutdown with
+// SwapEnforcer.Close or the StopAutoLoadPolicy method of the enforcer
 func WithAutoLoadPolicy(auto bool, per time.Duration) Option {
 	return func(o *options) {
 		o.autoLoadPolicy = auto
@@ -102,11 +133,146 @@ func WithCasbinPolicy(policy persist.Adapter) Option {
 	}
 }
 
+// WithFunction add a custom matcher function to the enforcer, registered again
+// when the model is reloaded and on the enforcers validating transactions
+func WithFunction(name string, function govaluate.ExpressionFunction) Option {
+	return func(o *options) {
+		if o.functions == nil {
+			o.functions = make(map[string]govaluate.ExpressionFunction)
+		}
+		o.functions[name] = function
+	}
+}
+
+// WithEnforcer use an existing enforcer, e.g. to share it between Server and HTTPFilter
+func WithEnforcer(enforcer *casbinV2.SyncedEnforcer) Option {
+	return func(o *options) {
+		o.enforcer = enforcer
+	}
+}
+
+// WithTenantRegistry enable tenant routing, the enforcer of each request is selected from the registry
+func WithTenantRegistry(registry *TenantRegistry) Option {
+	return func(o *options) {
+		o.tenants = registry
+	}
+}
+
+// WithTenantResolver set the tenant resolver, the domain of the security user is used by default
+func WithTenantResolver(resolver TenantResolver) Option {
+	return func(o *options) {
+		o.tenantResolver = resolver
+	}
+}
+
 // loadRbacModel 加载RBAC模型
 func loadRbacModel() (model.Model, error) {
 	return model.NewModelFromString(defaultRBACModel)
 }
 
+// NewEnforcer creates a validated enforcer from the model and policy options,
+// to be shared with WithEnforcer.
+func NewEnforcer(opts ...Option) (*casbinV2.SyncedEnforcer, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.model == nil {
+		o.model, _ = loadRbacModel()
+	}
+	return newEnforcer(o)
+}
+
+// newEnforcer validates the model against the configured options and creates
+// the enforcer, reporting policy load failures instead of discarding them.
+func newEnforcer(o *options) (*casbinV2.SyncedEnforcer, error) {
+	if err := validateModel(o.model, o.enableDomain); err != nil {
+		return nil, err
+	}
+
+	params := []interface{}{o.model}
+	if o.policy != nil {
+		params = append(params, o.policy)
+	}
+
+	enforcer, err := casbinV2.NewSyncedEnforcer(params...)
+	if err != nil {
+		return nil, fmt.Errorf("casbin: load policy: %w", err)
+	}
+
+	if err = validatePolicy(enforcer.GetModel()); err != nil {
+		return nil, err
+	}
+	if err = validateTemporalRoles(enforcer.GetModel(), o.temporalRoles); err != nil {
+		return nil, err
+	}
+	if len(o.temporalRoles) > 0 {
+		registerLinkConditions(enforcer.Enforcer, o.temporalRoles)
+	}
+
+	if err = o.setupFunctions(enforcer.Enforcer); err != nil {
+		return nil, err
+	}
+
+	return enforcer, nil
+}
+
+// CandidateTxOption sets up the enforcers validating the policy of a
+// transaction as NewEnforcer does with the options, e.g. with the functions,
+// the domain matching function and the temporal roles.
+func CandidateTxOption(opts ...Option) policy.TxOption {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return policy.WithCandidateSetup(func(candidate *casbinV2.Enforcer) error {
+		if err := o.setupFunctions(candidate); err != nil {
+			return err
+		}
+		registerLinkConditions(candidate, o.temporalRoles)
+		return nil
+	})
+}
+
+// setupSharedEnforcer registers the functions and the window conditions on
+// the enforcer passed by WithEnforcer
+func (o *options) setupSharedEnforcer(enforcer *casbinV2.SyncedEnforcer) error {
+	if err := validateTemporalRoles(enforcer.GetModel(), o.temporalRoles); err != nil {
+		return err
+	}
+	enforcer.GetLock().Lock()
+	defer enforcer.GetLock().Unlock()
+	if err := o.setupFunctions(enforcer.Enforcer); err != nil {
+		return err
+	}
+	registerLinkConditions(enforcer.Enforcer, o.temporalRoles)
+	return nil
+}
+
+// setupFunctions registers the custom functions and the domain matching
+// function on the enforcer
+func (o *options) setupFunctions(enforcer *casbinV2.Enforcer) error {
+	for name, function := range o.functions {
+		enforcer.AddFunction(name, function)
+	}
+	if o.domainMatchingFunc == nil {
+		return nil
+	}
+	if err := o.domainHierarchy.Validate(); err != nil {
+		return err
+	}
+	enforcer.AddNamedDomainMatchingFunc("g", DomainMatchFunctionName, o.domainMatchingFunc)
+	enforcer.AddFunction(DomainMatchFunctionName, func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return false, fmt.Errorf("%s expects 2 arguments, got %d", DomainMatchFunctionName, len(args))
+		}
+		domain, _ := args[0].(string)
+		ancestor, _ := args[1].(string)
+		return o.domainMatchingFunc(domain, ancestor), nil
+	})
+	return nil
+}
+
 func Server(opts ...Option) middleware.Middleware {
 	o := &options{
 		securityUserCreator: nil,
@@ -115,57 +281,210 @@ func Server(opts ...Option) middleware.Middleware {
 		opt(o)
 	}
 
+	initErr := o.init()
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			securityUser, err := o.parseSecurityUser(ctx, initErr)
+			if err != nil {
+				return nil, err
+			}
+
+			ctx = context.WithValue(ctx, SecurityUserContextKey, securityUser)
+			if err := o.authorize(ctx, securityUser); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// init creates the enforcer, or prepares the tenant registry, and starts policy reloading
+func (o *options) init() error {
 	if o.model == nil {
 		o.model, _ = loadRbacModel()
 	}
 
-	o.enforcer, _ = casbinV2.NewSyncedEnforcer(o.model, o.policy)
-	if o.enforcer != nil && o.watcher != nil {
-		_ = o.watcher.SetUpdateCallback(func(s string) {
-			_ = o.enforcer.LoadPolicy()
-		})
+	if o.tenants != nil {
+		o.tenants.options = *o
+		if o.tenantResolver == nil {
+			o.tenantResolver = tenantFromUser
+		}
+		return nil
+	}
+
+	if o.swap != nil {
+		if err := validateModel(o.swap.Enforcer().GetModel(), o.enableDomain); err != nil {
+			log.Errorf("casbin: invalid configuration: %v", err)
+			o.swap = nil
+			return err
+		}
+		if o.watcher != nil {
+			_ = o.watcher.SetUpdateCallback(o.onWatcherUpdate)
+		}
+		if o.autoLoadPolicy && o.autoLoadPolicyInterval > time.Duration(0) {
+			o.swap.StartAutoLoad(o.autoLoadPolicyInterval)
+		}
+		return nil
+	}
+
+	var err error
+	if o.enforcer != nil {
+		err = validateModel(o.enforcer.GetModel(), o.enableDomain)
+		if err == nil {
+			err = o.setupSharedEnforcer(o.enforcer)
+		}
+	} else {
+		o.enforcer, err = newEnforcer(o)
+	}
+	if err == nil && len(o.temporalRoles) > 0 && o.autoLoadPolicy {
+		err = ErrTemporalAutoLoad
+	}
+	if err != nil {
+		log.Errorf("casbin: invalid configuration: %v", err)
+		o.enforcer = nil
+		return err
+	}
+	if o.watcher != nil {
+		// SetWatcher installs a default callback, so ours is set afterwards
 		_ = o.enforcer.SetWatcher(o.watcher)
+		_ = o.watcher.SetUpdateCallback(o.onWatcherUpdate)
 	}
 	// set autoload policy
-	if o.enforcer != nil && o.autoLoadPolicy && o.autoLoadPolicyInterval > time.Duration(0) {
+	if o.autoLoadPolicy && o.autoLoadPolicyInterval > time.Duration(0) {
 		if !o.enforcer.IsAutoLoadingRunning() {
 			o.enforcer.StartAutoLoadPolicy(o.autoLoadPolicyInterval)
 		}
 	}
-	return func(handler middleware.Handler) middleware.Handler {
-		return func(ctx context.Context, req interface{}) (interface{}, error) {
-			var (
-				allowed bool
-				err     error
-			)
+	return nil
+}
 
-			if o.enforcer == nil {
-				return nil, ErrEnforcerMissing
-			}
-			if o.securityUserCreator == nil {
-				return nil, ErrSecurityUserCreatorMissing
-			}
+// currentEnforcer returns the shared enforcer, the current one of the swap enforcer when set
+func (o *options) currentEnforcer() *casbinV2.SyncedEnforcer {
+	if o.swap != nil {
+		return o.swap.Enforcer()
+	}
+	return o.enforcer
+}
 
-			securityUser := o.securityUserCreator()
-			if err := securityUser.ParseFromContext(ctx); err != nil {
-				return nil, ErrSecurityParseFailed
-			}
+// temporalPTypes returns the temporal role definitions of the shared enforcer,
+// those of the swap enforcer when set
+func (o *options) temporalPTypes() []string {
+	if o.swap != nil {
+		return o.swap.o.temporalRoles
+	}
+	return o.temporalRoles
+}
 
-			ctx = context.WithValue(ctx, SecurityUserContextKey, securityUser)
-			if o.enableDomain {
-				allowed, err = o.enforcer.Enforce(securityUser.GetSubject(), securityUser.GetDomain(), securityUser.GetObject(), securityUser.GetAction())
-			} else {
-				allowed, err = o.enforcer.Enforce(securityUser.GetSubject(), securityUser.GetObject(), securityUser.GetAction())
-			}
-			if err != nil {
-				return nil, err
-			}
-			if !allowed {
-				return nil, ErrUnauthorized
-			}
-			return handler(ctx, req)
-		}
+// reloadPolicy reloads the policy of the enforcer and publishes the changes
+func (o *options) reloadPolicy() {
+	var before policy.Rules
+	if len(o.publishers) > 0 {
+		before = rulesOf(o.currentEnforcer())
+	}
+
+	var err error
+	switch {
+	case o.swap != nil:
+		err = o.swap.LoadPolicy()
+	case len(o.temporalRoles) > 0:
+		err = loadTemporalPolicy(o.enforcer, o.temporalRoles)
+	default:
+		err = o.enforcer.LoadPolicy()
+	}
+	if err != nil {
+		log.Errorf("casbin: reload policy: %v", err)
+		return
+	}
+	if len(o.publishers) == 0 {
+		return
+	}
+	o.publish(policy.Diff(before, rulesOf(o.currentEnforcer())))
+}
+
+func rulesOf(enforcer *casbinV2.SyncedEnforcer) policy.Rules {
+	enforcer.GetLock().RLock()
+	defer enforcer.GetLock().RUnlock()
+	return policy.FromModel(enforcer.GetModel())
+}
+
+// publish publishes the policy changes applied from the watcher
+func (o *options) publish(changes policy.Changeset) {
+	if len(o.publishers) == 0 || changes.Empty() {
+		return
+	}
+	event := policy.Event{Source: policy.SourceReload, Time: time.Now(), Changes: changes}
+	if err := o.publishers.Publish(context.Background(), event); err != nil {
+		log.Errorf("casbin: publish policy changes: %v", err)
+	}
+}
+
+// parseSecurityUser creates the security user of the request
+func (o *options) parseSecurityUser(ctx context.Context, initErr error) (authz.SecurityUser, error) {
+	if o.currentEnforcer() == nil && o.tenants == nil {
+		return nil, ErrEnforcerMissing.WithCause(initErr)
+	}
+	if o.securityUserCreator == nil {
+		return nil, ErrSecurityUserCreatorMissing
+	}
+
+	securityUser := o.securityUserCreator()
+	if err := securityUser.ParseFromContext(ctx); err != nil {
+		return nil, ErrSecurityParseFailed
+	}
+	return securityUser, nil
+}
+
+// authorize checks the security user against the policy and reports the decision to the hook
+func (o *options) authorize(ctx context.Context, securityUser authz.SecurityUser) error {
+	return o.decide(ctx, o.evaluate(ctx, securityUser))
+}
+
+// evaluate returns the authorization decision of the user, without reporting it
+func (o *options) evaluate(ctx context.Context, securityUser authz.SecurityUser) Decision {
+	if o.bypassed(securityUser) {
+		return Decision{SecurityUser: securityUser, Allowed: true, Bypassed: true}
+	}
+
+	var request []interface{}
+	if o.enableDomain {
+		request = []interface{}{securityUser.GetSubject(), securityUser.GetDomain(), securityUser.GetObject(), securityUser.GetAction()}
+	} else {
+		request = []interface{}{securityUser.GetSubject(), securityUser.GetObject(), securityUser.GetAction()}
+	}
+
+	if o.operations != nil && !o.operations.Contains(securityUser.GetObject()) {
+		return Decision{SecurityUser: securityUser, Request: request, Err: ErrOperationUnmapped}
+	}
+
+	enforcer, err := o.enforcerFor(ctx, securityUser)
+	if err != nil {
+		return Decision{SecurityUser: securityUser, Request: request, Err: err}
+	}
+
+	allowed, err := enforcer.Enforce(request...)
+	if err == nil && !allowed {
+		err = ErrUnauthorized
+	}
+	return Decision{SecurityUser: securityUser, Request: request, Allowed: allowed && err == nil, Err: err}
+}
+
+// enforcerFor returns the enforcer serving the request, selected by tenant when tenant routing is enabled
+func (o *options) enforcerFor(ctx context.Context, securityUser authz.SecurityUser) (*casbinV2.SyncedEnforcer, error) {
+	if o.tenants == nil {
+		return o.currentEnforcer(), nil
+	}
+
+	tenant, err := o.tenantResolver(ctx, securityUser)
+	if err != nil || tenant == "" {
+		return nil, ErrTenantMissing
+	}
+
+	enforcer, err := o.tenants.Enforcer(ctx, tenant)
+	if err != nil {
+		return nil, ErrEnforcerMissing.WithCause(err)
 	}
+	return enforcer, nil
 }
 
 func Client(opts ...Option) middleware.Middleware {
@@ -180,7 +499,7 @@ func Client(opts ...Option) middleware.Middleware {
 		o.model, _ = loadRbacModel()
 	}
 
-	o.enforcer, _ = casbinV2.NewSyncedEnforcer(o.model, o.policy)
+	o.enforcer, _ = newEnforcer(o)
 
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (interface{}, error) {
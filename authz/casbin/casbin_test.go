@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"strings"
 	"testing"
 
@@ -14,6 +13,7 @@ import (
 	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
 	fileAdapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
 
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/middleware/auth/jwt"
@@ -22,6 +22,7 @@ import (
 	jwtV5 "github.com/golang-jwt/jwt/v5"
 
 	"github.com/tx7do/kratos-casbin/authz"
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
 )
 
 const (
@@ -56,20 +57,6 @@ p, dataset1_admin, /dataset1/*, *
 g, cathy, dataset1_admin
 `
 
-type headerCarrier http.Header
-
-func (hc headerCarrier) Get(key string) string { return http.Header(hc).Get(key) }
-
-func (hc headerCarrier) Set(key string, value string) { http.Header(hc).Set(key, value) }
-
-func (hc headerCarrier) Keys() []string {
-	keys := make([]string, 0, len(hc))
-	for k := range http.Header(hc) {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
 type Transport struct {
 	kind      transport.Kind
 	endpoint  string
@@ -335,3 +322,154 @@ func TestServer(t *testing.T) {
 func TestClient(t *testing.T) {
 
 }
+
+func TestValidate(t *testing.T) {
+	const domainModel = `
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && keyMatch(r.obj, p.obj) && r.act == p.act
+`
+	const noRoleModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`
+
+	dm, _ := model.NewModelFromString(domainModel)
+	nm, _ := model.NewModelFromString(noRoleModel)
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr string
+	}{
+		{
+			name: "default model",
+			opts: []Option{},
+		},
+		{
+			name:    "domain support with default model",
+			opts:    []Option{WithDomainSupport()},
+			wantErr: "remove WithDomainSupport",
+		},
+		{
+			name:    "domain model without domain support",
+			opts:    []Option{WithCasbinModel(dm)},
+			wantErr: "enable WithDomainSupport",
+		},
+		{
+			name: "domain model with domain support",
+			opts: []Option{WithCasbinModel(dm), WithDomainSupport()},
+		},
+		{
+			name:    "missing role definition",
+			opts:    []Option{WithCasbinModel(nm)},
+			wantErr: "no role definition \"g\"",
+		},
+		{
+			name: "policy arity mismatch",
+			opts: []Option{
+				WithCasbinModel(func() model.Model { m, _ := model.NewModelFromString(domainModel); return m }()),
+				WithCasbinPolicy(fileAdapter.NewAdapter("../../examples/authz_policy.csv")),
+				WithDomainSupport(),
+			},
+			wantErr: "load policy: invalid policy rule size",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.opts...)
+			if test.wantErr == "" {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.wantErr)
+			}
+		})
+	}
+
+	t.Run("server reports invalid configuration", func(t *testing.T) {
+		next := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "reply", nil
+		}
+		ctx := transport.NewServerContext(context.Background(), &Transport{operation: "/api/login"})
+		ctx = jwt.NewContext(ctx, createToken("admin"))
+
+		_, err := Server(
+			WithDomainSupport(),
+			WithSecurityUserCreator(NewSecurityUser),
+		)(next)(ctx, "request")
+		assert.True(t, errors.Is(err, ErrEnforcerMissing))
+		assert.Contains(t, errors.Unwrap(err).Error(), "request definition")
+	})
+}
+
+// updateWatcher is a watcher whose updates are triggered by the test.
+type updateWatcher struct {
+	callback func(string)
+}
+
+func (w *updateWatcher) SetUpdateCallback(callback func(string)) error {
+	w.callback = callback
+	return nil
+}
+
+func (w *updateWatcher) Update() error {
+	w.callback("")
+	return nil
+}
+
+func (w *updateWatcher) Close() {}
+
+func TestWatcherReloadPublisher(t *testing.T) {
+	a := stringAdapter.NewAdapter(`p, bobo, /api/*, *`)
+	w := &updateWatcher{}
+	publisher := policy.NewChannelPublisher(1)
+
+	server := Server(
+		WithCasbinPolicy(a),
+		WithWatcher(w),
+		WithPublisher(publisher),
+		WithSecurityUserCreator(NewSecurityUser),
+	)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+
+	ctx := transport.NewServerContext(context.Background(), &Transport{operation: "/api/users"})
+	ctx = jwt.NewContext(ctx, createToken("alice"))
+	_, err := server(ctx, "request")
+	assert.Equal(t, ErrUnauthorized, err)
+
+	a.Line = "p, bobo, /api/*, *\np, alice, /api/*, *"
+	assert.Nil(t, w.Update())
+
+	event := <-publisher.Events()
+	assert.Equal(t, policy.SourceReload, event.Source)
+	assert.Equal(t, policy.Changeset{
+		{Section: "p", PType: "p", Added: [][]string{{"alice", "/api/*", "*"}}},
+	}, event.Changes)
+
+	_, err = server(ctx, "request")
+	assert.Nil(t, err)
+}
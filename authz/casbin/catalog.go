@@ -0,0 +1,170 @@
+package casbin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/util"
+
+	"google.golang.org/grpc"
+)
+
+// OperationCatalog is the set of operations served by the application, such
+// as "/admin.v1.AdminService/Login".
+type OperationCatalog map[string]struct{}
+
+// NewOperationCatalog create a catalog of the given operations.
+func NewOperationCatalog(operations ...string) OperationCatalog {
+	c := make(OperationCatalog, len(operations))
+	c.Add(operations...)
+	return c
+}
+
+// OperationsFromServiceInfo returns the operations of the services registered
+// on a gRPC server, e.g. from grpc.Server.GetServiceInfo.
+func OperationsFromServiceInfo(services map[string]grpc.ServiceInfo) []string {
+	var operations []string
+	for name, info := range services {
+		for _, method := range info.Methods {
+			operations = append(operations, "/"+name+"/"+method.Name)
+		}
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+// Add adds operations to the catalog.
+func (c OperationCatalog) Add(operations ...string) {
+	for _, operation := range operations {
+		c[operation] = struct{}{}
+	}
+}
+
+// Contains reports whether the operation is in the catalog.
+func (c OperationCatalog) Contains(operation string) bool {
+	_, ok := c[operation]
+	return ok
+}
+
+// Operations returns the sorted operations of the catalog.
+func (c OperationCatalog) Operations() []string {
+	operations := make([]string, 0, len(c))
+	for operation := range c {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+// WithOperationCatalog deny every request whose object is not in the catalog,
+// whatever the policy says
+func WithOperationCatalog(catalog OperationCatalog) Option {
+	return func(o *options) {
+		o.operations = catalog
+	}
+}
+
+// ObjectMatchFunc reports whether a requested object matches the object of a rule.
+type ObjectMatchFunc func(object, pattern string) bool
+
+// CoverageReport describes how the policy covers an operation catalog.
+type CoverageReport struct {
+	// UnmappedOperations are operations matched by no rule.
+	UnmappedOperations []string `json:"unmappedOperations"`
+	// WildcardOnlyOperations are operations matched only by wildcard rules, with no explicit rule.
+	WildcardOnlyOperations []string `json:"wildcardOnlyOperations"`
+	// DeadRules are rules matching no known operation.
+	DeadRules [][]string `json:"deadRules"`
+	// UnreachableSubjects are subjects none of whose rules match a known operation.
+	UnreachableSubjects []string `json:"unreachableSubjects"`
+}
+
+// Coverage reports the policy coverage of the catalog, matching rule objects
+// with match, keyMatch when nil.
+func Coverage(enforcer *casbinV2.SyncedEnforcer, catalog OperationCatalog, match ObjectMatchFunc) (*CoverageReport, error) {
+	if match == nil {
+		match = util.KeyMatch
+	}
+
+	enforcer.GetLock().RLock()
+	defer enforcer.GetLock().RUnlock()
+	return coverage(enforcer.GetModel(), catalog, match)
+}
+
+func coverage(m model.Model, catalog OperationCatalog, match ObjectMatchFunc) (*CoverageReport, error) {
+	report := &CoverageReport{}
+	operations := catalog.Operations()
+	explicit := make(map[string]bool, len(operations))
+	matched := make(map[string]bool, len(operations))
+	subjects := make(map[string]bool)
+
+	ptypes := make([]string, 0, len(m["p"]))
+	for ptype := range m["p"] {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+
+	for _, ptype := range ptypes {
+		ast := m["p"][ptype]
+		subIndex, objIndex := tokenIndex(ast.Tokens, ptype+"_sub"), tokenIndex(ast.Tokens, ptype+"_obj")
+		if objIndex < 0 {
+			return nil, fmt.Errorf("casbin: policy definition %s = %s has no obj field", ptype, ast.Value)
+		}
+
+		for _, rule := range ast.Policy {
+			if objIndex >= len(rule) {
+				continue
+			}
+			pattern := rule[objIndex]
+
+			live := false
+			for _, operation := range operations {
+				if operation != pattern && !match(operation, pattern) {
+					continue
+				}
+				live = true
+				matched[operation] = true
+				if operation == pattern {
+					explicit[operation] = true
+				}
+			}
+			if !live {
+				report.DeadRules = append(report.DeadRules, append([]string{ptype}, rule...))
+			}
+
+			if subIndex >= 0 && subIndex < len(rule) {
+				subjects[rule[subIndex]] = subjects[rule[subIndex]] || live
+			}
+		}
+	}
+
+	for _, operation := range operations {
+		switch {
+		case !matched[operation]:
+			report.UnmappedOperations = append(report.UnmappedOperations, operation)
+		case !explicit[operation]:
+			report.WildcardOnlyOperations = append(report.WildcardOnlyOperations, operation)
+		}
+	}
+
+	for subject, live := range subjects {
+		if !live {
+			report.UnreachableSubjects = append(report.UnreachableSubjects, subject)
+		}
+	}
+	sort.Strings(report.UnreachableSubjects)
+
+	return report, nil
+}
+
+func tokenIndex(tokens []string, token string) int {
+	for i, t := range tokens {
+		if strings.EqualFold(t, token) {
+			return i
+		}
+	}
+	return -1
+}
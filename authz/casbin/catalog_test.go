@@ -0,0 +1,117 @@
+package casbin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthV1 "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/go-kratos/kratos/v2/middleware/auth/jwt"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+const catalogPolicy = `p, admin, /*, *
+p, alice, /admin.v1.AdminService/Login, *
+p, alice, /admin.v1.AdminService/ListUser, *
+p, bob, /admin.v1.AdminService/Users*, *
+p, bob, /legacy.v1.*, *
+p, carol, /legacy.v1.*, *
+g, cathy, admin`
+
+func TestOperationCatalog(t *testing.T) {
+	srv := grpc.NewServer()
+	healthV1.RegisterHealthServer(srv, health.NewServer())
+
+	catalog := NewOperationCatalog(OperationsFromServiceInfo(srv.GetServiceInfo())...)
+	assert.Equal(t, []string{
+		"/grpc.health.v1.Health/Check",
+		"/grpc.health.v1.Health/Watch",
+	}, catalog.Operations())
+	assert.True(t, catalog.Contains("/grpc.health.v1.Health/Check"))
+	assert.False(t, catalog.Contains("/grpc.health.v1.Health/Unknown"))
+}
+
+func TestServerWithOperationCatalog(t *testing.T) {
+	server := Server(
+		WithCasbinPolicy(stringAdapter.NewAdapter(catalogPolicy)),
+		WithSecurityUserCreator(NewSecurityUser),
+		WithOperationCatalog(NewOperationCatalog(
+			"/admin.v1.AdminService/Login",
+			"/admin.v1.AdminService/ListUser",
+		)),
+	)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+
+	tests := []struct {
+		name        string
+		authorityId string
+		path        string
+		exceptErr   error
+	}{
+		{
+			name:        "mapped operation",
+			authorityId: "cathy",
+			path:        "/admin.v1.AdminService/ListUser",
+		},
+		{
+			name:        "unmapped operation with wildcard policy",
+			authorityId: "cathy",
+			path:        "/admin.v1.AdminService/DeleteUser",
+			exceptErr:   ErrOperationUnmapped,
+		},
+		{
+			name:        "mapped operation without policy",
+			authorityId: "bob",
+			path:        "/admin.v1.AdminService/Login",
+			exceptErr:   ErrUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := transport.NewServerContext(context.Background(), &Transport{operation: test.path})
+			ctx = jwt.NewContext(ctx, createToken(test.authorityId))
+
+			_, err := server(ctx, "request")
+			assert.Equal(t, test.exceptErr, err)
+		})
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	enforcer, err := NewEnforcer(WithCasbinPolicy(stringAdapter.NewAdapter(catalogPolicy)))
+	assert.Nil(t, err)
+
+	report, err := Coverage(enforcer, NewOperationCatalog(
+		"/admin.v1.AdminService/Login",
+		"/admin.v1.AdminService/ListUser",
+		"/admin.v1.AdminService/DeleteUser",
+	), nil)
+	assert.Nil(t, err)
+	assert.Empty(t, report.UnmappedOperations)
+	assert.Equal(t, []string{"/admin.v1.AdminService/DeleteUser"}, report.WildcardOnlyOperations)
+	assert.Equal(t, [][]string{
+		{"p", "bob", "/admin.v1.AdminService/Users*", "*"},
+		{"p", "bob", "/legacy.v1.*", "*"},
+		{"p", "carol", "/legacy.v1.*", "*"},
+	}, report.DeadRules)
+	assert.Equal(t, []string{"bob", "carol"}, report.UnreachableSubjects)
+
+	_, err = enforcer.RemovePolicy("admin", "/*", "*")
+	assert.Nil(t, err)
+	report, err = Coverage(enforcer, NewOperationCatalog(
+		"/admin.v1.AdminService/Login",
+		"/admin.v1.AdminService/DeleteUser",
+	), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/admin.v1.AdminService/DeleteUser"}, report.UnmappedOperations)
+	assert.Empty(t, report.WildcardOnlyOperations)
+	assert.Equal(t, []string{"bob", "carol"}, report.UnreachableSubjects)
+}
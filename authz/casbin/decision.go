@@ -0,0 +1,72 @@
+package casbin
+
+import (
+	"context"
+
+	"github.com/tx7do/kratos-casbin/authz"
+)
+
+// Decision describes the outcome of an authorization check.
+type Decision struct {
+	// SecurityUser is the parsed user of the request.
+	SecurityUser authz.SecurityUser
+	// Request is the tuple passed to the enforcer, it is empty when enforcement was bypassed.
+	Request []interface{}
+	// Allowed reports whether the request is let through.
+	Allowed bool
+	// Bypassed reports whether enforcement was skipped by a bypass rule.
+	Bypassed bool
+	// Recheck reports whether the decision re-evaluates an open stream, see StreamGuard.
+	Recheck bool
+	// Err is the error returned to the caller when the request is rejected.
+	Err error
+}
+
+// DecisionHook is called with every authorization decision, e.g. for auditing.
+type DecisionHook func(ctx context.Context, decision Decision)
+
+// BypassFunc reports whether the user skips enforcement entirely.
+type BypassFunc func(user authz.SecurityUser) bool
+
+// WithDecisionHook set the hook receiving every authorization decision
+func WithDecisionHook(hook DecisionHook) Option {
+	return func(o *options) {
+		o.decisionHook = hook
+	}
+}
+
+// WithBypassSubjects let the given subjects, e.g. break-glass accounts, skip enforcement
+func WithBypassSubjects(subjects ...string) Option {
+	set := make(map[string]struct{}, len(subjects))
+	for _, subject := range subjects {
+		set[subject] = struct{}{}
+	}
+	return WithBypass(func(user authz.SecurityUser) bool {
+		_, ok := set[user.GetSubject()]
+		return ok
+	})
+}
+
+// WithBypass let the users matching the predicate skip enforcement,
+// every bypass is reported to the decision hook
+func WithBypass(bypass BypassFunc) Option {
+	return func(o *options) {
+		o.bypass = append(o.bypass, bypass)
+	}
+}
+
+func (o *options) bypassed(user authz.SecurityUser) bool {
+	for _, bypass := range o.bypass {
+		if bypass(user) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *options) decide(ctx context.Context, decision Decision) error {
+	if o.decisionHook != nil {
+		o.decisionHook(ctx, decision)
+	}
+	return decision.Err
+}
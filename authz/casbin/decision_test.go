@@ -0,0 +1,96 @@
+package casbin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/casbin/casbin/v2/model"
+	fileAdapter "github.com/casbin/casbin/v2/persist/file-adapter"
+
+	"github.com/go-kratos/kratos/v2/middleware/auth/jwt"
+	"github.com/go-kratos/kratos/v2/transport"
+
+	"github.com/tx7do/kratos-casbin/authz"
+)
+
+func TestBypass(t *testing.T) {
+	m, _ := model.NewModelFromFile("../../examples/authz_model.conf")
+	a := fileAdapter.NewAdapter("../../examples/authz_policy.csv")
+
+	var decisions []Decision
+	server := Server(
+		WithCasbinModel(m),
+		WithCasbinPolicy(a),
+		WithSecurityUserCreator(NewSecurityUser),
+		WithBypassSubjects("break-glass"),
+		WithBypass(func(user authz.SecurityUser) bool {
+			return user.GetSubject() == "svc-billing"
+		}),
+		WithDecisionHook(func(ctx context.Context, decision Decision) {
+			decisions = append(decisions, decision)
+		}),
+	)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+
+	tests := []struct {
+		name        string
+		authorityId string
+		path        string
+		allowed     bool
+		bypassed    bool
+	}{
+		{
+			name:        "policy allows",
+			authorityId: "admin",
+			path:        "/api/login",
+			allowed:     true,
+		},
+		{
+			name:        "policy denies",
+			authorityId: "alice",
+			path:        "/api/login",
+		},
+		{
+			name:        "bypass subject",
+			authorityId: "break-glass",
+			path:        "/api/login",
+			allowed:     true,
+			bypassed:    true,
+		},
+		{
+			name:        "bypass predicate",
+			authorityId: "svc-billing",
+			path:        "/dataset2/resource1",
+			allowed:     true,
+			bypassed:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decisions = nil
+
+			ctx := transport.NewServerContext(context.Background(), &Transport{operation: test.path})
+			ctx = jwt.NewContext(ctx, createToken(test.authorityId))
+
+			_, err := server(ctx, "request")
+			assert.Equal(t, test.allowed, err == nil)
+
+			if assert.Len(t, decisions, 1) {
+				decision := decisions[0]
+				assert.Equal(t, test.allowed, decision.Allowed)
+				assert.Equal(t, test.bypassed, decision.Bypassed)
+				assert.Equal(t, test.authorityId, decision.SecurityUser.GetSubject())
+				assert.Equal(t, err, decision.Err)
+				if test.bypassed {
+					assert.Empty(t, decision.Request)
+				} else {
+					assert.Equal(t, []interface{}{test.authorityId, test.path, "*"}, decision.Request)
+				}
+			}
+		})
+	}
+}
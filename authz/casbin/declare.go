@@ -0,0 +1,203 @@
+package casbin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/util"
+)
+
+var ErrDeclaredPolicyReadOnly = errors.New("casbin: declared policy is read-only")
+
+var (
+	_ persist.Adapter      = (*DeclaredPolicy)(nil)
+	_ persist.BatchAdapter = (*DeclaredPolicy)(nil)
+)
+
+// Declaration is a part of a policy declared in code, see Role and Assign.
+type Declaration interface {
+	declare(p *DeclaredPolicy)
+}
+
+// RoleDeclaration declares the permissions of a role.
+type RoleDeclaration struct {
+	name    string
+	grants  [][]string
+	parents []string
+}
+
+// Role declares a role, e.g. Role("admin").Can("/admin.v1.AdminService/*", "*").
+func Role(name string) *RoleDeclaration {
+	return &RoleDeclaration{name: name}
+}
+
+// Can grants the actions on the object, "*" when no action is given. The
+// object may be a keyMatch pattern.
+func (r *RoleDeclaration) Can(object string, actions ...string) *RoleDeclaration {
+	if len(actions) == 0 {
+		actions = []string{"*"}
+	}
+	for _, action := range actions {
+		r.grants = append(r.grants, []string{object, action})
+	}
+	return r
+}
+
+// Inherits grants the permissions of the roles to the role.
+func (r *RoleDeclaration) Inherits(roles ...string) *RoleDeclaration {
+	r.parents = append(r.parents, roles...)
+	return r
+}
+
+func (r *RoleDeclaration) declare(p *DeclaredPolicy) {
+	if _, ok := p.roles[r.name]; !ok {
+		p.roles[r.name] = struct{}{}
+		p.order = append(p.order, r.name)
+	}
+	for _, grant := range r.grants {
+		p.permissions = append(p.permissions, append([]string{r.name}, grant...))
+	}
+	for _, parent := range r.parents {
+		p.inheritances = append(p.inheritances, []string{r.name, parent})
+	}
+}
+
+type assignment struct {
+	user  string
+	roles []string
+}
+
+// Assign assigns the roles to the user.
+func Assign(user string, roles ...string) Declaration {
+	return assignment{user: user, roles: roles}
+}
+
+func (a assignment) declare(p *DeclaredPolicy) {
+	for _, role := range a.roles {
+		p.assignments = append(p.assignments, []string{a.user, role})
+	}
+}
+
+// DeclaredPolicy is a read-only persist.Adapter loading the rules declared in
+// code into models with "p = sub, obj, act" and "g = _, _".
+type DeclaredPolicy struct {
+	roles        map[string]struct{}
+	order        []string
+	permissions  [][]string
+	inheritances [][]string
+	assignments  [][]string
+}
+
+// NewDeclaredPolicy builds the policy of the declarations. Every role must
+// be declared and every object must match an operation of the catalog, with
+// keyMatch; operations are not checked when catalog is nil.
+func NewDeclaredPolicy(catalog OperationCatalog, declarations ...Declaration) (*DeclaredPolicy, error) {
+	p := &DeclaredPolicy{roles: make(map[string]struct{})}
+	for _, declaration := range declarations {
+		declaration.declare(p)
+	}
+	if err := p.validate(catalog); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *DeclaredPolicy) validate(catalog OperationCatalog) error {
+	var problems []string
+
+	for _, role := range p.order {
+		if role == "" {
+			problems = append(problems, "empty role name")
+		}
+	}
+	for _, rule := range p.permissions {
+		if rule[1] == "" || rule[2] == "" {
+			problems = append(problems, fmt.Sprintf("role %q: empty object or action", rule[0]))
+		} else if catalog != nil && !matchesCatalog(catalog, rule[1]) {
+			problems = append(problems, fmt.Sprintf("role %q: %s matches no operation", rule[0], rule[1]))
+		}
+	}
+	for _, rule := range p.inheritances {
+		if _, ok := p.roles[rule[1]]; !ok {
+			problems = append(problems, fmt.Sprintf("role %q: inherits undeclared role %q", rule[0], rule[1]))
+		}
+	}
+	for _, rule := range p.assignments {
+		if rule[0] == "" {
+			problems = append(problems, fmt.Sprintf("role %q: assigned to an empty user", rule[1]))
+		}
+		if _, ok := p.roles[rule[1]]; !ok {
+			problems = append(problems, fmt.Sprintf("user %q: assigned undeclared role %q", rule[0], rule[1]))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("casbin: invalid declared policy: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func matchesCatalog(catalog OperationCatalog, pattern string) bool {
+	if catalog.Contains(pattern) {
+		return true
+	}
+	for operation := range catalog {
+		if util.KeyMatch(operation, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles returns the declared roles, in declaration order.
+func (p *DeclaredPolicy) Roles() []string {
+	return append([]string(nil), p.order...)
+}
+
+// LoadPolicy loads the declared rules: permissions, inheritances, then assignments.
+func (p *DeclaredPolicy) LoadPolicy(m model.Model) error {
+	for _, rules := range []struct {
+		ptype string
+		rules [][]string
+	}{{"p", p.permissions}, {"g", p.inheritances}, {"g", p.assignments}} {
+		for _, rule := range rules.rules {
+			if err := persist.LoadPolicyArray(append([]string{rules.ptype}, rule...), m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SavePolicy fails, the policy is declared in code.
+func (p *DeclaredPolicy) SavePolicy(model.Model) error {
+	return ErrDeclaredPolicyReadOnly
+}
+
+// AddPolicy fails, the policy is declared in code.
+func (p *DeclaredPolicy) AddPolicy(string, string, []string) error {
+	return ErrDeclaredPolicyReadOnly
+}
+
+// AddPolicies fails, the policy is declared in code.
+func (p *DeclaredPolicy) AddPolicies(string, string, [][]string) error {
+	return ErrDeclaredPolicyReadOnly
+}
+
+// RemovePolicies fails, the policy is declared in code.
+func (p *DeclaredPolicy) RemovePolicies(string, string, [][]string) error {
+	return ErrDeclaredPolicyReadOnly
+}
+
+// RemovePolicy fails, the policy is declared in code.
+func (p *DeclaredPolicy) RemovePolicy(string, string, []string) error {
+	return ErrDeclaredPolicyReadOnly
+}
+
+// RemoveFilteredPolicy fails, the policy is declared in code.
+func (p *DeclaredPolicy) RemoveFilteredPolicy(string, string, int, ...string) error {
+	return ErrDeclaredPolicyReadOnly
+}
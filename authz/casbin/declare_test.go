@@ -0,0 +1,78 @@
+package casbin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+func TestDeclaredPolicy(t *testing.T) {
+	catalog := NewOperationCatalog(
+		"/admin.v1.AdminService/Login",
+		"/admin.v1.AdminService/ListUser",
+		"/admin.v1.AdminService/DeleteUser",
+	)
+
+	declared, err := NewDeclaredPolicy(catalog,
+		Role("viewer").Can("/admin.v1.AdminService/ListUser", "GET"),
+		Role("admin").Can("/admin.v1.AdminService/*").Inherits("viewer"),
+		Role("viewer").Can("/admin.v1.AdminService/Login", "GET", "POST"),
+		Assign("cathy", "admin"),
+		Assign("dave", "viewer", "viewer"),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"viewer", "admin"}, declared.Roles())
+
+	enforcer, err := NewEnforcer(WithCasbinPolicy(declared))
+	assert.Nil(t, err)
+	policies, _ := enforcer.GetPolicy()
+	assert.Equal(t, [][]string{
+		{"viewer", "/admin.v1.AdminService/ListUser", "GET"},
+		{"admin", "/admin.v1.AdminService/*", "*"},
+		{"viewer", "/admin.v1.AdminService/Login", "GET"},
+		{"viewer", "/admin.v1.AdminService/Login", "POST"},
+	}, policies)
+
+	allowed, _ := enforcer.Enforce("cathy", "/admin.v1.AdminService/DeleteUser", "DELETE")
+	assert.True(t, allowed)
+	allowed, _ = enforcer.Enforce("dave", "/admin.v1.AdminService/ListUser", "GET")
+	assert.True(t, allowed)
+	allowed, _ = enforcer.Enforce("dave", "/admin.v1.AdminService/DeleteUser", "DELETE")
+	assert.False(t, allowed)
+
+	// read-only
+	_, err = enforcer.AddPolicy("dave", "/admin.v1.AdminService/DeleteUser", "DELETE")
+	assert.Equal(t, ErrDeclaredPolicyReadOnly, err)
+	_, err = enforcer.AddPolicies([][]string{{"dave", "/admin.v1.AdminService/DeleteUser", "DELETE"}})
+	assert.Equal(t, ErrDeclaredPolicyReadOnly, err)
+	_, err = enforcer.RemoveGroupingPolicies([][]string{{"cathy", "admin"}})
+	assert.Equal(t, ErrDeclaredPolicyReadOnly, err)
+	_, err = policy.Begin(enforcer).Remove("g", "cathy", "admin").Commit()
+	assert.ErrorIs(t, err, ErrDeclaredPolicyReadOnly)
+	assert.Equal(t, ErrDeclaredPolicyReadOnly, enforcer.SavePolicy())
+	allowed, _ = enforcer.Enforce("cathy", "/admin.v1.AdminService/DeleteUser", "DELETE")
+	assert.True(t, allowed)
+}
+
+func TestDeclaredPolicyValidation(t *testing.T) {
+	catalog := NewOperationCatalog("/admin.v1.AdminService/Login")
+
+	_, err := NewDeclaredPolicy(catalog,
+		Role("admin").Can("/admin.v1.AdminSevice/*").Inherits("auditor"),
+		Role("viewer").Can("/admin.v1.AdminService/Login", ""),
+		Assign("cathy", "admni"),
+		Assign("", "admin"),
+	)
+	assert.EqualError(t, err, "casbin: invalid declared policy: "+
+		`role "admin": /admin.v1.AdminSevice/* matches no operation; `+
+		`role "viewer": empty object or action; `+
+		`role "admin": inherits undeclared role "auditor"; `+
+		`user "cathy": assigned undeclared role "admni"; `+
+		`role "admin": assigned to an empty user`)
+
+	// operations are not checked without a catalog
+	_, err = NewDeclaredPolicy(nil, Role("admin").Can("/anything/*"))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,70 @@
+package casbin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/casbin/casbin/v2/rbac"
+)
+
+// DomainMatchFunctionName is the matcher function registered together with a
+// domain matching function, use it to let permissions flow to child domains:
+//
+//	m = g(r.sub, p.sub, r.dom) && domainMatch(r.dom, p.dom) && keyMatch(r.obj, p.obj) && r.act == p.act
+const DomainMatchFunctionName = "domainMatch"
+
+// DomainHierarchy maps a domain to its parent domain, e.g. team → department → organisation.
+type DomainHierarchy map[string]string
+
+// Match reports whether ancestor is the domain itself or one of its parents.
+func (h DomainHierarchy) Match(domain, ancestor string) bool {
+	for depth := 0; depth <= len(h); depth++ {
+		if domain == ancestor {
+			return true
+		}
+		parent, ok := h[domain]
+		if !ok {
+			return false
+		}
+		domain = parent
+	}
+	return false
+}
+
+// Validate checks that the hierarchy has no cycles.
+func (h DomainHierarchy) Validate() error {
+	for domain := range h {
+		seen := map[string]bool{domain: true}
+		for parent, ok := h[domain]; ok; parent, ok = h[parent] {
+			if seen[parent] {
+				return fmt.Errorf("casbin: domain hierarchy has a cycle at %q", parent)
+			}
+			seen[parent] = true
+		}
+	}
+	return nil
+}
+
+// PathDomainMatch returns a domain matching function for path-like domains,
+// where "org1/dept1/team1" inherits from "org1/dept1" and "org1".
+func PathDomainMatch(sep string) rbac.MatchingFunc {
+	return func(domain, ancestor string) bool {
+		return domain == ancestor || strings.HasPrefix(domain, ancestor+sep)
+	}
+}
+
+// WithDomainMatchingFunc set the function deciding whether roles and
+// permissions granted in a domain apply to a requested domain
+func WithDomainMatchingFunc(fn rbac.MatchingFunc) Option {
+	return func(o *options) {
+		o.domainMatchingFunc = fn
+	}
+}
+
+// WithDomainHierarchy enable inheritance along explicit parent links between domains
+func WithDomainHierarchy(hierarchy DomainHierarchy) Option {
+	return func(o *options) {
+		o.domainHierarchy = hierarchy
+		o.domainMatchingFunc = hierarchy.Match
+	}
+}
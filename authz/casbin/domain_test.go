@@ -0,0 +1,197 @@
+package casbin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"github.com/go-kratos/kratos/v2/middleware/auth/jwt"
+	"github.com/go-kratos/kratos/v2/transport"
+
+	jwtV5 "github.com/golang-jwt/jwt/v5"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+	"github.com/tx7do/kratos-casbin/authz/casbin/policytest"
+)
+
+const hierarchyModelConfig = `
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act, eft
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && domainMatch(r.dom, p.dom) && keyMatch(r.obj, p.obj) && r.act == p.act
+`
+
+func TestDomainHierarchy(t *testing.T) {
+	hierarchy := DomainHierarchy{
+		"dept1": "org1",
+		"team1": "dept1",
+		"team2": "dept1",
+	}
+
+	assert.True(t, hierarchy.Match("team1", "team1"))
+	assert.True(t, hierarchy.Match("team1", "org1"))
+	assert.False(t, hierarchy.Match("org1", "team1"))
+	assert.False(t, hierarchy.Match("team1", "team2"))
+	assert.Nil(t, hierarchy.Validate())
+
+	cyclic := DomainHierarchy{"a": "b", "b": "c", "c": "a"}
+	assert.False(t, cyclic.Match("a", "d"))
+	assert.Error(t, cyclic.Validate())
+}
+
+func TestDomainInheritance(t *testing.T) {
+	const policy = `p, admin, org1, /api/*, GET, allow
+p, admin, team2, /api/secret, GET, deny
+g, alice, admin, org1
+g, bob, admin, dept1`
+
+	const pathPolicy = `p, admin, org1, /api/*, GET, allow
+p, admin, org1/dept1/team2, /api/secret, GET, deny
+g, alice, admin, org1
+g, bob, admin, org1/dept1`
+
+	tests := []struct {
+		name    string
+		opt     Option
+		policy  string
+		domains map[string]string
+	}{
+		{
+			name: "explicit parent links",
+			opt: WithDomainHierarchy(DomainHierarchy{
+				"dept1": "org1",
+				"team1": "dept1",
+				"team2": "dept1",
+			}),
+			policy: policy,
+			domains: map[string]string{
+				"org1": "org1", "dept1": "dept1", "team1": "team1", "team2": "team2",
+			},
+		},
+		{
+			name:   "path domains",
+			opt:    WithDomainMatchingFunc(PathDomainMatch("/")),
+			policy: pathPolicy,
+			domains: map[string]string{
+				"org1": "org1", "dept1": "org1/dept1", "team1": "org1/dept1/team1", "team2": "org1/dept1/team2",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, _ := model.NewModelFromString(hierarchyModelConfig)
+			o := &options{enableDomain: true, model: m, policy: stringAdapter.NewAdapter(test.policy)}
+			test.opt(o)
+
+			enforcer, err := newEnforcer(o)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			cases := []struct {
+				sub, dom, obj string
+				allowed       bool
+			}{
+				{"alice", "org1", "/api/users", true},
+				{"alice", "team1", "/api/users", true},
+				{"alice", "team1", "/api/secret", true},
+				{"alice", "team2", "/api/secret", false},
+				{"alice", "team2", "/api/users", true},
+				{"bob", "org1", "/api/users", false},
+				{"bob", "team1", "/api/users", true},
+				{"bob", "team2", "/api/secret", false},
+				{"alice", "org2", "/api/users", false},
+			}
+			for _, c := range cases {
+				allowed, err := enforcer.Enforce(c.sub, test.domains[c.dom], c.obj, "GET")
+				assert.Nil(t, err)
+				assert.Equal(t, c.allowed, allowed, "%s in %s on %s", c.sub, c.dom, c.obj)
+			}
+		})
+	}
+
+	t.Run("cyclic hierarchy", func(t *testing.T) {
+		m, _ := model.NewModelFromString(hierarchyModelConfig)
+		err := Validate(
+			WithCasbinModel(m),
+			WithDomainSupport(),
+			WithDomainHierarchy(DomainHierarchy{"a": "b", "b": "a"}),
+		)
+		assert.Error(t, err)
+	})
+}
+
+func TestDomainCandidateTxOption(t *testing.T) {
+	m, _ := model.NewModelFromString(hierarchyModelConfig)
+	opts := []Option{
+		WithCasbinModel(m),
+		WithDomainSupport(),
+		WithCasbinPolicy(stringAdapter.NewAdapter(`p, admin, org, /*, GET, allow`)),
+		WithDomainMatchingFunc(PathDomainMatch("/")),
+	}
+	enforcer, err := NewEnforcer(opts...)
+	assert.Nil(t, err)
+	enforcer.EnableAutoSave(false)
+
+	suite := &policytest.Suite{Cases: []policytest.Case{
+		{Subject: "alice", Domain: "org/team", Object: "/x", Action: "GET", Expect: policytest.ExpectAllow},
+	}}
+	validator := policy.WithValidator(policy.SuiteValidator(suite))
+
+	// the candidate misses the domain matching function
+	_, err = policy.Begin(enforcer, validator).Add("g", "alice", "admin", "org").Commit()
+	assert.Error(t, err)
+
+	_, err = policy.Begin(enforcer, validator, CandidateTxOption(opts...)).Add("g", "alice", "admin", "org").Commit()
+	assert.Nil(t, err)
+	allowed, err := enforcer.Enforce("alice", "org/team", "/x", "GET")
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	// custom functions are set up by the caller
+	var candidates int
+	_, err = policy.Begin(enforcer, CandidateTxOption(opts...), validator,
+		policy.WithCandidateSetup(func(candidate *casbinV2.Enforcer) error {
+			candidates++
+			return nil
+		}),
+	).Add("g", "bob", "admin", "org").Commit()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, candidates)
+}
+
+func TestServerWithDomainHierarchy(t *testing.T) {
+	m, _ := model.NewModelFromString(hierarchyModelConfig)
+	server := Server(
+		WithCasbinModel(m),
+		WithCasbinPolicy(stringAdapter.NewAdapter("p, admin, org1, /api/*, *, allow\ng, alice, admin, org1")),
+		WithDomainSupport(),
+		WithDomainHierarchy(DomainHierarchy{"dept1": "org1"}),
+		WithSecurityUserCreator(NewSecurityUser),
+	)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+
+	ctx := transport.NewServerContext(context.Background(), &Transport{operation: "/api/users"})
+	_, err := server(jwt.NewContext(ctx, jwtV5.MapClaims{ClaimAuthorityId: "alice", Domain: "dept1"}), "request")
+	assert.Nil(t, err)
+
+	_, err = server(jwt.NewContext(ctx, jwtV5.MapClaims{ClaimAuthorityId: "alice", Domain: "org2"}), "request")
+	assert.Error(t, err)
+}
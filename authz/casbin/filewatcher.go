@@ -0,0 +1,250 @@
+package casbin
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	fileAdapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/go-kratos/kratos/v2/log"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+// WatcherUpdateForModel is the method of the messages sent by FileWatcher
+// when the model file changed.
+const WatcherUpdateForModel = "UpdateForModel"
+
+const (
+	defaultFilePollInterval = time.Second
+	defaultFileDebounce     = 100 * time.Millisecond
+)
+
+// FileWatcherOption is a file watcher option.
+type FileWatcherOption func(*FileWatcher)
+
+// WithFilePolling poll the files every interval instead of using file system notifications
+func WithFilePolling(interval time.Duration) FileWatcherOption {
+	return func(w *FileWatcher) {
+		w.pollInterval = interval
+	}
+}
+
+// WithFileDebounce wait for the files to settle for the duration before validating them
+func WithFileDebounce(d time.Duration) FileWatcherOption {
+	return func(w *FileWatcher) {
+		w.debounce = d
+	}
+}
+
+// FileWatcher is a persist.Watcher notifying changes of local model and
+// policy files. Changes are validated first: files which do not parse are
+// reported with the logger and the current policy is kept.
+//
+// Used with WithWatcher, model changes replace the model of the enforcer and
+// policy changes reload its policy.
+type FileWatcher struct {
+	modelPath    string
+	policyPath   string
+	pollInterval time.Duration
+	debounce     time.Duration
+
+	mu          sync.Mutex
+	callback    func(string)
+	model       model.Model
+	modelHash   [sha256.Size]byte
+	policyHash  [sha256.Size]byte
+	notify      *fsnotify.Watcher
+	stop        chan struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+	lastInvalid [2][sha256.Size]byte
+}
+
+// NewFileWatcher watches the model and policy files, which must be valid.
+// File system notifications are used, or polling when they are unavailable.
+func NewFileWatcher(modelPath, policyPath string, opts ...FileWatcherOption) (*FileWatcher, error) {
+	w := &FileWatcher{
+		modelPath:  modelPath,
+		policyPath: policyPath,
+		debounce:   defaultFileDebounce,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	m, modelHash, policyHash, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.model, w.modelHash, w.policyHash = m, modelHash, policyHash
+
+	if w.pollInterval <= 0 {
+		if w.notify, err = w.watchFiles(); err != nil {
+			log.Warnf("casbin: file watcher: %v, polling files instead", err)
+			w.pollInterval = defaultFilePollInterval
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *FileWatcher) watchFiles() (*fsnotify.Watcher, error) {
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// directories are watched as editors often replace files instead of writing them
+	dirs := map[string]struct{}{filepath.Dir(w.modelPath): {}, filepath.Dir(w.policyPath): {}}
+	for dir := range dirs {
+		if err = notify.Add(dir); err != nil {
+			_ = notify.Close()
+			return nil, err
+		}
+	}
+	return notify, nil
+}
+
+func (w *FileWatcher) run() {
+	defer close(w.done)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+		poll   <-chan time.Time
+		settle *time.Timer
+	)
+	if w.notify != nil {
+		events, errs = w.notify.Events, w.notify.Errors
+	} else {
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	settle = time.NewTimer(time.Hour)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case event := <-events:
+			if w.concerns(event.Name) {
+				settle.Reset(w.debounce)
+			}
+		case err := <-errs:
+			log.Errorf("casbin: file watcher: %v", err)
+		case <-settle.C:
+			w.check()
+		case <-poll:
+			w.check()
+		}
+	}
+}
+
+func (w *FileWatcher) concerns(name string) bool {
+	name = filepath.Clean(name)
+	return name == filepath.Clean(w.modelPath) || name == filepath.Clean(w.policyPath)
+}
+
+// load parses and validates the files.
+func (w *FileWatcher) load() (model.Model, [sha256.Size]byte, [sha256.Size]byte, error) {
+	var modelHash, policyHash [sha256.Size]byte
+
+	modelData, err := os.ReadFile(w.modelPath)
+	if err != nil {
+		return nil, modelHash, policyHash, err
+	}
+	policyData, err := os.ReadFile(w.policyPath)
+	if err != nil {
+		return nil, modelHash, policyHash, err
+	}
+	modelHash, policyHash = sha256.Sum256(modelData), sha256.Sum256(policyData)
+
+	m, err := model.NewModelFromString(string(modelData))
+	if err != nil {
+		return nil, modelHash, policyHash, err
+	}
+	loaded := m.Copy()
+	if err = fileAdapter.NewAdapter(w.policyPath).LoadPolicy(loaded); err != nil {
+		return nil, modelHash, policyHash, err
+	}
+	if err = validatePolicy(loaded); err != nil {
+		return nil, modelHash, policyHash, err
+	}
+	return m, modelHash, policyHash, nil
+}
+
+// check validates changed files and notifies the callback.
+func (w *FileWatcher) check() {
+	m, modelHash, policyHash, err := w.load()
+
+	w.mu.Lock()
+	if err != nil {
+		// report a broken content once
+		if invalid := [2][sha256.Size]byte{modelHash, policyHash}; invalid != w.lastInvalid {
+			w.lastInvalid = invalid
+			log.Errorf("casbin: file watcher: invalid model or policy, keeping the current one: %v", err)
+		}
+		w.mu.Unlock()
+		return
+	}
+
+	method := ""
+	switch {
+	case modelHash != w.modelHash:
+		method = WatcherUpdateForModel
+		w.model = m
+	case policyHash != w.policyHash:
+		method = WatcherUpdate
+	}
+	w.modelHash, w.policyHash = modelHash, policyHash
+	callback := w.callback
+	w.mu.Unlock()
+
+	if method == "" || callback == nil {
+		return
+	}
+	msg, _ := json.Marshal(WatcherMessage{Method: method})
+	callback(string(msg))
+}
+
+// Model returns the last valid model.
+func (w *FileWatcher) Model() model.Model {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return policy.CopyModel(w.model)
+}
+
+// SetUpdateCallback sets the callback called with a WatcherMessage when the files change.
+func (w *FileWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update does nothing, changes are detected on the files.
+func (w *FileWatcher) Update() error {
+	return nil
+}
+
+// Close stops watching the files.
+func (w *FileWatcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+		<-w.done
+		if w.notify != nil {
+			_ = w.notify.Close()
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package casbin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/casbin/casbin/v2/model"
+	fileAdapter "github.com/casbin/casbin/v2/persist/file-adapter"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/auth/jwt"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+const fileWatcherModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`
+
+func writeFile(t *testing.T, path, content string) {
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func testFileWatcher(t *testing.T, opts ...FileWatcherOption) {
+	dir := t.TempDir()
+	modelPath, policyPath := filepath.Join(dir, "model.conf"), filepath.Join(dir, "policy.csv")
+	writeFile(t, modelPath, fileWatcherModel)
+	writeFile(t, policyPath, "p, bobo, /api/users, *\n")
+
+	w, err := NewFileWatcher(modelPath, policyPath, opts...)
+	assert.Nil(t, err)
+	defer w.Close()
+
+	m, err := model.NewModelFromFile(modelPath)
+	assert.Nil(t, err)
+	var server middleware.Handler = Server(
+		WithCasbinModel(m),
+		WithCasbinPolicy(fileAdapter.NewAdapter(policyPath)),
+		WithWatcher(w),
+		WithSecurityUserCreator(NewSecurityUser),
+	)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+
+	allowed := func(path string) func() bool {
+		return func() bool {
+			ctx := transport.NewServerContext(context.Background(), &Transport{operation: path})
+			ctx = jwt.NewContext(ctx, createToken("alice"))
+			_, err := server(ctx, "request")
+			return err == nil
+		}
+	}
+	assert.False(t, allowed("/api/users")())
+
+	writeFile(t, policyPath, "p, bobo, /api/users, *\np, alice, /api/*, *\n")
+	// the object only matches literally until the model changes
+	assert.Never(t, allowed("/api/users"), 300*time.Millisecond, 20*time.Millisecond)
+
+	// an invalid policy is not loaded
+	writeFile(t, policyPath, "p, alice, /api/*\n")
+	writeFile(t, modelPath, strings.Replace(fileWatcherModel, "r.obj == p.obj", "keyMatch(r.obj, p.obj)", 1))
+	assert.Never(t, allowed("/api/users"), 300*time.Millisecond, 20*time.Millisecond)
+
+	writeFile(t, policyPath, "p, bobo, /api/users, *\np, alice, /api/*, *\n")
+	assert.Eventually(t, allowed("/api/users"), 2*time.Second, 20*time.Millisecond)
+	assert.True(t, allowed("/api/orders")())
+
+	// an invalid model is not loaded
+	writeFile(t, modelPath, "[request_definition]\nr = sub, obj, act\n")
+	writeFile(t, policyPath, "p, bobo, /api/users, *\n")
+	assert.Never(t, func() bool { return !allowed("/api/orders")() }, 300*time.Millisecond, 20*time.Millisecond)
+}
+
+func TestFileWatcher(t *testing.T) {
+	testFileWatcher(t, WithFileDebounce(10*time.Millisecond))
+}
+
+func TestFileWatcherPolling(t *testing.T) {
+	testFileWatcher(t, WithFilePolling(10*time.Millisecond))
+}
@@ -0,0 +1,150 @@
+package casbin
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// UnaryServerInterceptor returns a gRPC unary interceptor performing the same
+// enforcement as Server, for servers not built with Kratos middleware.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	o := &options{
+		securityUserCreator: nil,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	initErr := o.init()
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := o.authorizeGRPC(ctx, info.FullMethod, initErr)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC stream interceptor performing the same
+// enforcement as Server when the stream is opened, and while it is open when
+// WithStreamReauthorization is set.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	o := &options{
+		securityUserCreator: nil,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	initErr := o.init()
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := o.authorizeGRPC(ss.Context(), info.FullMethod, initErr)
+		if err != nil {
+			return err
+		}
+		if !o.streamReauthorization {
+			return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		securityUser, _ := SecurityUserFromContext(ctx)
+		guard := newStreamGuard(ctx, o, securityUser)
+		go guard.Run(ctx, cancel)
+
+		err = handler(srv, &guardedStream{ServerStream: ss, ctx: ctx, guard: guard})
+		if guardErr := guard.Err(); guardErr != nil {
+			return guardErr
+		}
+		return err
+	}
+}
+
+// authorizeGRPC authorizes the call and returns the context carrying the security user
+func (o *options) authorizeGRPC(ctx context.Context, fullMethod string, initErr error) (context.Context, error) {
+	if _, ok := transport.FromServerContext(ctx); !ok {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			md = metadata.MD{}
+		}
+		ctx = transport.NewServerContext(ctx, &grpcTransport{operation: fullMethod, reqHeader: headerCarrierMD(md)})
+	}
+
+	securityUser, err := o.parseSecurityUser(ctx, initErr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, SecurityUserContextKey, securityUser)
+	if err = o.authorize(ctx, securityUser); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// serverStream overrides the context of the wrapped stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+type headerCarrierMD metadata.MD
+
+func (mc headerCarrierMD) Get(key string) string {
+	vals := metadata.MD(mc).Get(key)
+	if len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func (mc headerCarrierMD) Set(key string, value string) { metadata.MD(mc).Set(key, value) }
+
+func (mc headerCarrierMD) Add(key string, value string) { metadata.MD(mc).Append(key, value) }
+
+func (mc headerCarrierMD) Keys() []string {
+	keys := make([]string, 0, len(mc))
+	for k := range metadata.MD(mc) {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (mc headerCarrierMD) Values(key string) []string { return metadata.MD(mc).Get(key) }
+
+// grpcTransport is the server transport of calls not served by the Kratos gRPC server.
+type grpcTransport struct {
+	operation string
+	reqHeader headerCarrierMD
+}
+
+func (tr *grpcTransport) Kind() transport.Kind {
+	return transport.KindGRPC
+}
+
+func (tr *grpcTransport) Endpoint() string {
+	return ""
+}
+
+func (tr *grpcTransport) Operation() string {
+	return tr.operation
+}
+
+func (tr *grpcTransport) RequestHeader() transport.Header {
+	return tr.reqHeader
+}
+
+func (tr *grpcTransport) ReplyHeader() transport.Header {
+	return headerCarrierMD{}
+}
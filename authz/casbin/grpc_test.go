@@ -0,0 +1,116 @@
+package casbin
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthV1 "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newBufconnClient(t *testing.T, opts ...grpc.ServerOption) (healthV1.HealthClient, *health.Server) {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(opts...)
+	hs := health.NewServer()
+	healthV1.RegisterHealthServer(srv, hs)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return healthV1.NewHealthClient(conn), hs
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	enforcer, err := NewEnforcer(
+		WithCasbinPolicy(stringAdapter.NewAdapter("p, alice, /grpc.health.v1.Health/*, GET\np, bob, /grpc.health.v1.Health/Check, GET")),
+	)
+	assert.Nil(t, err)
+
+	client, _ := newBufconnClient(t,
+		grpc.UnaryInterceptor(UnaryServerInterceptor(
+			WithEnforcer(enforcer),
+			WithSecurityUserCreator(newHeaderSecurityUser),
+		)),
+		grpc.StreamInterceptor(StreamServerInterceptor(
+			WithEnforcer(enforcer),
+			WithSecurityUserCreator(newHeaderSecurityUser),
+		)),
+	)
+
+	tests := []struct {
+		name   string
+		user   string
+		stream bool
+		code   codes.Code
+	}{
+		{
+			name: "unary allowed",
+			user: "alice",
+			code: codes.OK,
+		},
+		{
+			name:   "stream allowed",
+			user:   "alice",
+			stream: true,
+			code:   codes.OK,
+		},
+		{
+			name: "unary allowed by exact method",
+			user: "bob",
+			code: codes.OK,
+		},
+		{
+			name:   "stream denied",
+			user:   "bob",
+			stream: true,
+			code:   codes.PermissionDenied,
+		},
+		{
+			name: "unary anonymous",
+			code: codes.PermissionDenied,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.user != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-user", test.user)
+			}
+
+			if test.stream {
+				stream, err := client.Watch(ctx, &healthV1.HealthCheckRequest{})
+				assert.Nil(t, err)
+				_, err = stream.Recv()
+				assert.Equal(t, test.code, status.Code(err))
+				return
+			}
+
+			_, err := client.Check(ctx, &healthV1.HealthCheckRequest{})
+			assert.Equal(t, test.code, status.Code(err))
+		})
+	}
+}
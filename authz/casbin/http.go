@@ -0,0 +1,147 @@
+package casbin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+
+	"github.com/tx7do/kratos-casbin/authz"
+)
+
+// HTTPFilter returns a net/http filter performing the same enforcement as Server,
+// using the request path as object and the request method as action. It can be
+// passed to the Kratos http.Filter server option to protect handlers registered
+// with HandlePrefix, or wrap any plain http.Handler. Paths with dot segments or
+// repeated slashes are rejected, the wrapped handler could resolve them to
+// another object than the authorized one.
+func HTTPFilter(opts ...Option) func(http.Handler) http.Handler {
+	o := &options{
+		securityUserCreator: nil,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	initErr := o.init()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !canonicalPath(r.URL.Path) {
+				writeHTTPError(w, ErrPathNotCanonical)
+				return
+			}
+
+			ctx := r.Context()
+			if _, ok := transport.FromServerContext(ctx); !ok {
+				ctx = transport.NewServerContext(ctx, &httpTransport{request: r, replyHeader: headerCarrier(w.Header())})
+			}
+
+			parsed, err := o.parseSecurityUser(ctx, initErr)
+			if err != nil {
+				writeHTTPError(w, err)
+				return
+			}
+
+			securityUser := &httpSecurityUser{SecurityUser: parsed, path: r.URL.Path, method: r.Method}
+			ctx = context.WithValue(ctx, SecurityUserContextKey, securityUser)
+			if err = o.authorize(ctx, securityUser); err != nil {
+				writeHTTPError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// canonicalPath reports whether the path is absolute and unchanged by path.Clean,
+// but for a trailing slash.
+func canonicalPath(p string) bool {
+	if p == "" || p[0] != '/' {
+		return false
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned == p
+}
+
+// httpSecurityUser enforces the request path and method instead of the operation.
+type httpSecurityUser struct {
+	authz.SecurityUser
+	path   string
+	method string
+}
+
+func (su *httpSecurityUser) GetObject() string {
+	return su.path
+}
+
+func (su *httpSecurityUser) GetAction() string {
+	return su.method
+}
+
+type headerCarrier http.Header
+
+func (hc headerCarrier) Get(key string) string { return http.Header(hc).Get(key) }
+
+func (hc headerCarrier) Set(key string, value string) { http.Header(hc).Set(key, value) }
+
+func (hc headerCarrier) Add(key string, value string) { http.Header(hc).Add(key, value) }
+
+func (hc headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(hc))
+	for k := range http.Header(hc) {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (hc headerCarrier) Values(key string) []string { return http.Header(hc).Values(key) }
+
+// httpTransport is the server transport of requests not served by the Kratos router.
+type httpTransport struct {
+	request     *http.Request
+	replyHeader headerCarrier
+}
+
+func (tr *httpTransport) Kind() transport.Kind {
+	return transport.KindHTTP
+}
+
+func (tr *httpTransport) Endpoint() string {
+	return tr.request.Host
+}
+
+func (tr *httpTransport) Operation() string {
+	return tr.request.URL.Path
+}
+
+func (tr *httpTransport) RequestHeader() transport.Header {
+	return headerCarrier(tr.request.Header)
+}
+
+func (tr *httpTransport) ReplyHeader() transport.Header {
+	return tr.replyHeader
+}
+
+func (tr *httpTransport) Request() *http.Request {
+	return tr.request
+}
+
+func (tr *httpTransport) PathTemplate() string {
+	return ""
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	se := errors.FromError(err)
+	body, _ := json.Marshal(se)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(se.Code))
+	_, _ = w.Write(body)
+}
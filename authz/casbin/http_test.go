@@ -0,0 +1,172 @@
+package casbin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"github.com/go-kratos/kratos/v2/transport"
+
+	"github.com/tx7do/kratos-casbin/authz"
+)
+
+// headerSecurityUser reads the subject from a request header.
+type headerSecurityUser struct {
+	subject   string
+	operation string
+}
+
+func (su *headerSecurityUser) ParseFromContext(ctx context.Context) error {
+	tr, ok := transport.FromServerContext(ctx)
+	if !ok {
+		return errors.New("transport missing")
+	}
+	su.subject = tr.RequestHeader().Get("X-User")
+	su.operation = tr.Operation()
+	if su.subject == "" {
+		return errors.New("user missing")
+	}
+	return nil
+}
+
+func (su *headerSecurityUser) GetSubject() string { return su.subject }
+func (su *headerSecurityUser) GetObject() string  { return su.operation }
+func (su *headerSecurityUser) GetAction() string  { return http.MethodGet }
+func (su *headerSecurityUser) GetDomain() string  { return "" }
+
+func newHeaderSecurityUser() authz.SecurityUser {
+	return &headerSecurityUser{}
+}
+
+func TestHTTPFilter(t *testing.T) {
+	enforcer, err := NewEnforcer(
+		WithCasbinPolicy(stringAdapter.NewAdapter("p, alice, /q/*, GET\np, bob, /q/openapi.yaml, *")),
+	)
+	assert.Nil(t, err)
+
+	var handled authz.SecurityUser
+	filter := HTTPFilter(
+		WithEnforcer(enforcer),
+		WithSecurityUserCreator(newHeaderSecurityUser),
+	)
+	h := filter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled, _ = SecurityUserFromContext(r.Context())
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		status int
+	}{
+		{
+			name:   "allowed by wildcard path",
+			user:   "alice",
+			method: http.MethodGet,
+			path:   "/q/swagger-ui/index.html",
+			status: http.StatusOK,
+		},
+		{
+			name:   "denied method",
+			user:   "alice",
+			method: http.MethodPost,
+			path:   "/q/openapi.yaml",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "allowed any method",
+			user:   "bob",
+			method: http.MethodDelete,
+			path:   "/q/openapi.yaml",
+			status: http.StatusOK,
+		},
+		{
+			name:   "denied path",
+			user:   "bob",
+			method: http.MethodGet,
+			path:   "/q/swagger-ui/index.html",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "anonymous",
+			method: http.MethodGet,
+			path:   "/q/openapi.yaml",
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handled = nil
+			r := httptest.NewRequest(test.method, test.path, nil)
+			if test.user != "" {
+				r.Header.Set("X-User", test.user)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, test.status, w.Code)
+			if test.status == http.StatusOK {
+				if assert.NotNil(t, handled) {
+					assert.Equal(t, test.user, handled.GetSubject())
+					assert.Equal(t, test.path, handled.GetObject())
+					assert.Equal(t, test.method, handled.GetAction())
+				}
+				return
+			}
+
+			var body struct {
+				Code   int    `json:"code"`
+				Reason string `json:"reason"`
+			}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, test.status, body.Code)
+			assert.Equal(t, reason, body.Reason)
+		})
+	}
+
+	t.Run("rejects path traversal", func(t *testing.T) {
+		for _, p := range []string{"/q/../admin", "/q/./openapi.yaml", "/q//openapi.yaml", "/q/%2e%2e/admin"} {
+			handled = nil
+			r := httptest.NewRequest(http.MethodGet, p, nil)
+			r.Header.Set("X-User", "alice")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusBadRequest, w.Code, p)
+			assert.Nil(t, handled, p)
+		}
+	})
+
+	t.Run("shares the enforcer with Server", func(t *testing.T) {
+		server := Server(
+			WithEnforcer(enforcer),
+			WithSecurityUserCreator(newHeaderSecurityUser),
+		)(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "reply", nil
+		})
+
+		_, err := enforcer.AddPolicy("carol", "/q/*", "GET")
+		assert.Nil(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/q/openapi.yaml", nil)
+		r.Header.Set("X-User", "carol")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		header := headerCarrier(http.Header{})
+		header.Set("X-User", "carol")
+		ctx := transport.NewServerContext(context.Background(), &Transport{operation: "/q/openapi.yaml", reqHeader: header})
+		_, err = server(ctx, "request")
+		assert.Nil(t, err)
+	})
+}
@@ -0,0 +1,370 @@
+package lint
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/util"
+)
+
+const (
+	CheckArity         = "arity"
+	CheckDuplicate     = "duplicate"
+	CheckShadowed      = "shadowed"
+	CheckRoleCycle     = "role-cycle"
+	CheckUndefinedRole = "undefined-role"
+	CheckInvalidEffect = "invalid-effect"
+	CheckUnmatchedRule = "unmatched-rule"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+const defaultGroupingType = "g"
+
+// Rule is a policy line, Values[0] is the policy type.
+type Rule struct {
+	Line   int      `json:"line"`
+	Values []string `json:"rule"`
+}
+
+func (r Rule) String() string {
+	return strings.Join(r.Values, ", ")
+}
+
+// Finding is a problem found in the policy.
+type Finding struct {
+	Check    string   `json:"check"`
+	Severity string   `json:"severity"`
+	Line     int      `json:"line,omitempty"`
+	Rule     []string `json:"rule,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (f Finding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("line %d: %s [%s]: %s", f.Line, f.Severity, f.Check, f.Message)
+	}
+	return fmt.Sprintf("%s [%s]: %s", f.Severity, f.Check, f.Message)
+}
+
+// LoadRules reads the rules of a policy CSV file, keeping duplicates and line numbers.
+func LoadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRules(f)
+}
+
+// ReadRules reads the rules of a policy in casbin CSV format.
+func ReadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(text))
+		reader.Comment = '#'
+		reader.TrimLeadingSpace = true
+		values, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		rules = append(rules, Rule{Line: line, Values: values})
+	}
+	return rules, scanner.Err()
+}
+
+// Lint checks the rules against the model. Rules whose object can never match
+// one of the operations are reported when operations are given.
+func Lint(m model.Model, rules []Rule, operations []string) []Finding {
+	l := &linter{model: m, operations: operations}
+	l.checkArity(rules)
+	l.checkDuplicates()
+	l.checkEffects()
+	l.checkShadowed()
+	l.checkRoleCycles()
+	l.checkUndefinedRoles()
+	l.checkUnmatched()
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		return l.findings[i].Line < l.findings[j].Line
+	})
+	return l.findings
+}
+
+// HasErrors reports whether any finding is an error.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	model      model.Model
+	operations []string
+	policies   []Rule
+	groupings  []Rule
+	findings   []Finding
+}
+
+func (l *linter) report(check, severity string, rule *Rule, format string, args ...interface{}) {
+	f := Finding{Check: check, Severity: severity, Message: fmt.Sprintf(format, args...)}
+	if rule != nil {
+		f.Line = rule.Line
+		f.Rule = rule.Values
+	}
+	l.findings = append(l.findings, f)
+}
+
+func (l *linter) field(rule Rule, name string) (string, bool) {
+	ptype := rule.Values[0]
+	for i, token := range l.model["p"][ptype].Tokens {
+		if token == ptype+"_"+name {
+			return rule.Values[i+1], true
+		}
+	}
+	return "", false
+}
+
+func (l *linter) checkArity(rules []Rule) {
+	for i := range rules {
+		rule := rules[i]
+		if len(rule.Values) < 2 {
+			l.report(CheckArity, SeverityError, &rule, "rule has no values")
+			continue
+		}
+
+		ptype := rule.Values[0]
+		if ptype == "" {
+			l.report(CheckArity, SeverityError, &rule, "rule has no policy type")
+			continue
+		}
+		sec := ptype[:1]
+		ast, ok := l.model[sec][ptype]
+		if !ok {
+			l.report(CheckArity, SeverityError, &rule, "policy type %q is not defined in the model", ptype)
+			continue
+		}
+
+		switch sec {
+		case "p":
+			if len(rule.Values)-1 != len(ast.Tokens) {
+				l.report(CheckArity, SeverityError, &rule, "rule has %d fields but %s = %s expects %d",
+					len(rule.Values)-1, ptype, ast.Value, len(ast.Tokens))
+				continue
+			}
+			l.policies = append(l.policies, rule)
+		case "g":
+			if count := strings.Count(ast.Value, "_"); len(rule.Values)-1 < count {
+				l.report(CheckArity, SeverityError, &rule, "rule has %d fields but %s = %s expects %d",
+					len(rule.Values)-1, ptype, ast.Value, count)
+				continue
+			}
+			l.groupings = append(l.groupings, rule)
+		default:
+			l.report(CheckArity, SeverityError, &rule, "policy type %q is not a policy or role definition", ptype)
+		}
+	}
+}
+
+func (l *linter) checkDuplicates() {
+	seen := make(map[string]int)
+	for _, rules := range [][]Rule{l.policies, l.groupings} {
+		for i := range rules {
+			key := strings.Join(rules[i].Values, ",")
+			if line, ok := seen[key]; ok {
+				l.report(CheckDuplicate, SeverityWarning, &rules[i], "rule duplicates line %d", line)
+				continue
+			}
+			seen[key] = rules[i].Line
+		}
+	}
+}
+
+func (l *linter) checkEffects() {
+	for i := range l.policies {
+		eft, ok := l.field(l.policies[i], "eft")
+		if !ok {
+			continue
+		}
+		if eft != "allow" && eft != "deny" {
+			l.report(CheckInvalidEffect, SeverityError, &l.policies[i], "effect %q is neither allow nor deny", eft)
+		}
+	}
+}
+
+// checkShadowed reports rules granting nothing more than a wildcard rule of the same subject.
+func (l *linter) checkShadowed() {
+	for i := range l.policies {
+		rule := l.policies[i]
+		for j := range l.policies {
+			other := l.policies[j]
+			if i == j || rule.Values[0] != other.Values[0] || !l.shadows(other, rule) {
+				continue
+			}
+			if l.shadows(rule, other) && j > i {
+				// equivalent rules are reported as duplicates
+				continue
+			}
+			l.report(CheckShadowed, SeverityWarning, &rule, "rule is shadowed by %q on line %d", other.String(), other.Line)
+			break
+		}
+	}
+}
+
+// shadows reports whether every request matched by rule is matched by wildcard with the same effect.
+func (l *linter) shadows(wildcard, rule Rule) bool {
+	ptype := rule.Values[0]
+	wide := false
+	for i, token := range l.model["p"][ptype].Tokens {
+		w, r := wildcard.Values[i+1], rule.Values[i+1]
+		if w == r {
+			continue
+		}
+		switch token {
+		case ptype + "_obj":
+			if !util.KeyMatch(r, w) {
+				return false
+			}
+		case ptype + "_act":
+			if w != "*" {
+				return false
+			}
+		default:
+			return false
+		}
+		wide = true
+	}
+	return wide
+}
+
+func (l *linter) checkRoleCycles() {
+	type key struct{ ptype, domain string }
+	graphs := make(map[key]map[string][]string)
+	var keys []key
+	for _, rule := range l.groupings {
+		k := key{ptype: rule.Values[0]}
+		if len(rule.Values) > 3 {
+			k.domain = rule.Values[3]
+		}
+		if graphs[k] == nil {
+			graphs[k] = make(map[string][]string)
+			keys = append(keys, k)
+		}
+		graphs[k][rule.Values[1]] = append(graphs[k][rule.Values[1]], rule.Values[2])
+	}
+
+	for _, k := range keys {
+		graph := graphs[k]
+		state := make(map[string]int)
+		var path []string
+		var visit func(string) []string
+		visit = func(node string) []string {
+			state[node] = 1
+			path = append(path, node)
+			for _, next := range graph[node] {
+				switch state[next] {
+				case 1:
+					for i, n := range path {
+						if n == next {
+							return append(append([]string{}, path[i:]...), next)
+						}
+					}
+				case 0:
+					if cycle := visit(next); cycle != nil {
+						return cycle
+					}
+				}
+			}
+			path = path[:len(path)-1]
+			state[node] = 2
+			return nil
+		}
+
+		nodes := make([]string, 0, len(graph))
+		for node := range graph {
+			nodes = append(nodes, node)
+		}
+		sort.Strings(nodes)
+		for _, node := range nodes {
+			if state[node] != 0 {
+				continue
+			}
+			path = path[:0]
+			if cycle := visit(node); cycle != nil {
+				where := ""
+				if k.domain != "" {
+					where = " in domain " + k.domain
+				}
+				l.report(CheckRoleCycle, SeverityError, nil, "%s role cycle%s: %s", k.ptype, where, strings.Join(cycle, " -> "))
+			}
+		}
+	}
+}
+
+// checkUndefinedRoles reports roles assigned in g rules which grant no permission and inherit no other role.
+func (l *linter) checkUndefinedRoles() {
+	defined := make(map[string]bool)
+	for _, rule := range l.policies {
+		if sub, ok := l.field(rule, "sub"); ok {
+			defined[sub] = true
+		}
+	}
+	for _, rule := range l.groupings {
+		if rule.Values[0] == defaultGroupingType {
+			defined[rule.Values[1]] = true
+		}
+	}
+
+	for i := range l.groupings {
+		rule := l.groupings[i]
+		if rule.Values[0] != defaultGroupingType {
+			continue
+		}
+		if role := rule.Values[2]; !defined[role] {
+			l.report(CheckUndefinedRole, SeverityError, &rule, "role %q has no permission and no parent role", role)
+		}
+	}
+}
+
+func (l *linter) checkUnmatched() {
+	if len(l.operations) == 0 {
+		return
+	}
+	for i := range l.policies {
+		obj, ok := l.field(l.policies[i], "obj")
+		if !ok {
+			continue
+		}
+		matched := false
+		for _, operation := range l.operations {
+			if operation == obj || util.KeyMatch(operation, obj) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			l.report(CheckUnmatchedRule, SeverityWarning, &l.policies[i], "object %q matches no known operation", obj)
+		}
+	}
+}
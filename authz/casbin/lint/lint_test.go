@@ -0,0 +1,93 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+const modelConfig = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch(r.obj, p.obj) && (r.act == p.act || p.act == "*")
+`
+
+const policyConfig = `# admin policy
+p, admin, /admin.v1.AdminService/*, *, allow
+p, admin, /admin.v1.AdminService/ListUser, GET, allow
+p, alice, /admin.v1.AdminService/Login, *, allow
+p, alice, /admin.v1.AdminService/Login, *, allow
+p, alice, /admin.v1.AdminService/Logout, *, maybe
+p, bob, /legacy.v1.*, GET, deny
+p, bob, /admin.v1.AdminService/Login, *
+g, cathy, admin
+g, dave, auditor
+g, r1, r2
+g, r2, r3
+g, r3, r1
+q, x, y
+, alice, /x, GET
+`
+
+func TestLint(t *testing.T) {
+	m, err := model.NewModelFromString(modelConfig)
+	assert.Nil(t, err)
+
+	rules, err := ReadRules(strings.NewReader(policyConfig))
+	assert.Nil(t, err)
+	assert.Len(t, rules, 14)
+	assert.Equal(t, 2, rules[0].Line)
+
+	findings := Lint(m, rules, []string{
+		"/admin.v1.AdminService/Login",
+		"/admin.v1.AdminService/Logout",
+		"/admin.v1.AdminService/ListUser",
+	})
+
+	got := make(map[string][]int)
+	for _, f := range findings {
+		got[f.Check] = append(got[f.Check], f.Line)
+	}
+	assert.Equal(t, map[string][]int{
+		CheckShadowed:      {3},
+		CheckDuplicate:     {5},
+		CheckInvalidEffect: {6},
+		CheckUnmatchedRule: {7},
+		CheckArity:         {8, 14, 15},
+		CheckUndefinedRole: {10},
+		CheckRoleCycle:     {0},
+	}, got)
+	assert.True(t, HasErrors(findings))
+
+	for _, f := range findings {
+		if f.Check == CheckRoleCycle {
+			assert.Equal(t, "g role cycle: r1 -> r2 -> r3 -> r1", f.Message)
+		}
+	}
+}
+
+func TestLintClean(t *testing.T) {
+	m, err := model.NewModelFromFile("../../../examples/authz_model.conf")
+	assert.Nil(t, err)
+
+	rules, err := LoadRules("../../../examples/authz_policy.csv")
+	assert.Nil(t, err)
+
+	findings := Lint(m, rules, nil)
+	assert.Empty(t, findings)
+	assert.False(t, HasErrors(findings))
+}
@@ -0,0 +1,330 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	fileAdapter "github.com/casbin/casbin/v2/persist/file-adapter"
+)
+
+// ErrNotApplied is returned when the enforcer rejects a batch of changes.
+var ErrNotApplied = errors.New("policy: changes not applied by the enforcer")
+
+// Rules maps a policy type, such as "p", "g" or "p2", to its rules.
+type Rules map[string][][]string
+
+// FromModel copies the rules of the model.
+func FromModel(m model.Model) Rules {
+	rules := make(Rules)
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range m[sec] {
+			if len(ast.Policy) == 0 {
+				continue
+			}
+			copied := make([][]string, len(ast.Policy))
+			for i, rule := range ast.Policy {
+				copied[i] = append([]string(nil), rule...)
+			}
+			rules[ptype] = copied
+		}
+	}
+	return rules
+}
+
+// CopyModel copies the model with the parameters of its role definitions, such
+// as "g = _, _, (_, _)", which Model.Copy drops, so that casbin creates their
+// conditional role managers. They are parsed from the definition as the
+// models loaded by casbin are copies too.
+func CopyModel(m model.Model) model.Model {
+	c := m.Copy()
+	for _, ast := range c["g"] {
+		start, end := strings.Index(ast.Value, "("), strings.Index(ast.Value, ")")
+		if start >= 0 && end > start {
+			ast.ParamsTokens = strings.Split(ast.Value[start+1:end], ",")
+		}
+	}
+	return c
+}
+
+// Load reads the rules of an adapter, the model only defines the policy types.
+func Load(m model.Model, a persist.Adapter) (Rules, error) {
+	loaded := m.Copy()
+	loaded.ClearPolicy()
+	if err := a.LoadPolicy(loaded); err != nil {
+		return nil, err
+	}
+	return FromModel(loaded), nil
+}
+
+// LoadFile reads the rules of a policy CSV file.
+func LoadFile(m model.Model, path string) (Rules, error) {
+	return Load(m, fileAdapter.NewAdapter(path))
+}
+
+// PTypes returns the sorted policy types.
+func (r Rules) PTypes() []string {
+	ptypes := make([]string, 0, len(r))
+	for ptype := range r {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+	return ptypes
+}
+
+// Change is the difference of one policy type.
+type Change struct {
+	Section string     `json:"section"`
+	PType   string     `json:"ptype"`
+	Added   [][]string `json:"added,omitempty"`
+	Removed [][]string `json:"removed,omitempty"`
+}
+
+// Changeset is the difference between two sets of rules, ordered by policy type.
+type Changeset []Change
+
+// Diff returns the changes turning from into to.
+func Diff(from, to Rules) Changeset {
+	ptypes := make(Rules, len(from)+len(to))
+	for ptype := range from {
+		ptypes[ptype] = nil
+	}
+	for ptype := range to {
+		ptypes[ptype] = nil
+	}
+
+	var changes Changeset
+	for _, ptype := range ptypes.PTypes() {
+		change := Change{Section: ptype[:1], PType: ptype}
+		change.Removed = subtract(from[ptype], to[ptype])
+		change.Added = subtract(to[ptype], from[ptype])
+		if len(change.Added) > 0 || len(change.Removed) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func subtract(a, b [][]string) [][]string {
+	exclude := make(map[string]struct{}, len(b))
+	for _, rule := range b {
+		exclude[key(rule)] = struct{}{}
+	}
+
+	var diff [][]string
+	for _, rule := range a {
+		k := key(rule)
+		if _, ok := exclude[k]; ok {
+			continue
+		}
+		exclude[k] = struct{}{}
+		diff = append(diff, rule)
+	}
+	return diff
+}
+
+func key(rule []string) string {
+	return strings.Join(rule, "\x00")
+}
+
+// Empty reports whether there is no change.
+func (c Changeset) Empty() bool {
+	return len(c) == 0
+}
+
+// Counts returns the number of added and removed rules.
+func (c Changeset) Counts() (added, removed int) {
+	for _, change := range c {
+		added += len(change.Added)
+		removed += len(change.Removed)
+	}
+	return added, removed
+}
+
+// String returns the changeset in a diff-like text form.
+func (c Changeset) String() string {
+	var sb strings.Builder
+	for _, change := range c {
+		for _, rule := range change.Removed {
+			fmt.Fprintf(&sb, "- %s, %s\n", change.PType, strings.Join(rule, ", "))
+		}
+		for _, rule := range change.Added {
+			fmt.Fprintf(&sb, "+ %s, %s\n", change.PType, strings.Join(rule, ", "))
+		}
+	}
+	return sb.String()
+}
+
+// Target receives incremental policy changes, persist.BatchAdapter implements it.
+type Target interface {
+	AddPolicies(sec string, ptype string, rules [][]string) error
+	RemovePolicies(sec string, ptype string, rules [][]string) error
+}
+
+// Apply applies the changeset to the target, removals first.
+func (c Changeset) Apply(target Target) error {
+	for _, change := range c {
+		if len(change.Removed) == 0 {
+			continue
+		}
+		if err := target.RemovePolicies(change.Section, change.PType, change.Removed); err != nil {
+			return fmt.Errorf("remove %s rules: %w", change.PType, err)
+		}
+	}
+	for _, change := range c {
+		if len(change.Added) == 0 {
+			continue
+		}
+		if err := target.AddPolicies(change.Section, change.PType, change.Added); err != nil {
+			return fmt.Errorf("add %s rules: %w", change.PType, err)
+		}
+	}
+	return nil
+}
+
+// Planner is a target previewing the changes it would apply, EnforcerTarget
+// implements it.
+type Planner interface {
+	Plan(changes Changeset) (Changeset, error)
+}
+
+// Plan returns the changes Apply would make to the target, without applying
+// them. Targets which are not a Planner apply every change.
+func (c Changeset) Plan(target Target) (Changeset, error) {
+	if planner, ok := target.(Planner); ok {
+		return planner.Plan(c)
+	}
+	return c, nil
+}
+
+// AdapterTarget returns a target writing to the adapter, one rule at a time
+// when it does not implement persist.BatchAdapter.
+func AdapterTarget(a persist.Adapter) Target {
+	if ba, ok := a.(persist.BatchAdapter); ok {
+		return ba
+	}
+	return adapterTarget{a}
+}
+
+type adapterTarget struct {
+	persist.Adapter
+}
+
+func (t adapterTarget) AddPolicies(sec string, ptype string, rules [][]string) error {
+	for _, rule := range rules {
+		if err := t.AddPolicy(sec, ptype, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t adapterTarget) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	for _, rule := range rules {
+		if err := t.RemovePolicy(sec, ptype, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnforcerTarget returns a target applying the changes through the enforcer,
+// updating its in-memory model and, with auto-save, its adapter. Rules already
+// added or removed are skipped, so a target that drifted from the source of
+// the changeset converges.
+func EnforcerTarget(e casbinV2.IEnforcer) Target {
+	return enforcerTarget{e}
+}
+
+type enforcerTarget struct {
+	casbinV2.IEnforcer
+}
+
+func (t enforcerTarget) AddPolicies(sec string, ptype string, rules [][]string) error {
+	// casbin skips the whole batch when one rule already exists
+	rules, err := t.filter(sec, ptype, rules, false)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+
+	var ok bool
+	if sec == "g" {
+		ok, err = t.AddNamedGroupingPolicies(ptype, rules)
+	} else {
+		ok, err = t.AddNamedPolicies(ptype, rules)
+	}
+	if err == nil && !ok {
+		err = ErrNotApplied
+	}
+	return err
+}
+
+func (t enforcerTarget) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	// casbin skips the whole batch when one rule is missing
+	rules, err := t.filter(sec, ptype, rules, true)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+
+	var ok bool
+	if sec == "g" {
+		ok, err = t.RemoveNamedGroupingPolicies(ptype, rules)
+	} else {
+		ok, err = t.RemoveNamedPolicies(ptype, rules)
+	}
+	if err == nil && !ok {
+		err = ErrNotApplied
+	}
+	return err
+}
+
+// Plan returns the changes without the rules already added or removed.
+func (t enforcerTarget) Plan(changes Changeset) (Changeset, error) {
+	var planned Changeset
+	for _, change := range changes {
+		removed, err := t.filter(change.Section, change.PType, change.Removed, true)
+		if err != nil {
+			return nil, err
+		}
+		added, err := t.filter(change.Section, change.PType, change.Added, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(added) > 0 || len(removed) > 0 {
+			planned = append(planned, Change{Section: change.Section, PType: change.PType, Added: added, Removed: removed})
+		}
+	}
+	return planned, nil
+}
+
+// filter returns the rules present in the enforcer, or the absent ones.
+func (t enforcerTarget) filter(sec string, ptype string, rules [][]string, present bool) ([][]string, error) {
+	var filtered [][]string
+	for _, rule := range rules {
+		params := make([]interface{}, len(rule))
+		for i, value := range rule {
+			params[i] = value
+		}
+
+		var (
+			has bool
+			err error
+		)
+		if sec == "g" {
+			has, err = t.HasNamedGroupingPolicy(ptype, params...)
+		} else {
+			has, err = t.HasNamedPolicy(ptype, params...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if has == present {
+			filtered = append(filtered, rule)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,177 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+)
+
+const modelConfig = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+p2 = sub, obj
+
+[role_definition]
+g = _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch(r.obj, p.obj) && (r.act == p.act || p.act == "*")
+`
+
+const fromPolicy = `p, admin, /*, *
+p, reader, /api/*, GET
+p2, auditor, /audit
+g, alice, admin
+g, bob, reader`
+
+const toPolicy = `p, admin, /*, *
+p, reader, /api/*, GET
+p, writer, /api/*, POST
+g, alice, admin
+g, bob, writer
+g2, carol, auditor`
+
+func newModel(t *testing.T) model.Model {
+	m, err := model.NewModelFromString(modelConfig)
+	assert.Nil(t, err)
+	return m
+}
+
+func TestDiff(t *testing.T) {
+	m := newModel(t)
+	from, err := Load(m, stringAdapter.NewAdapter(fromPolicy))
+	assert.Nil(t, err)
+	to, err := Load(m, stringAdapter.NewAdapter(toPolicy))
+	assert.Nil(t, err)
+
+	changes := Diff(from, to)
+	assert.Equal(t, Changeset{
+		{Section: "g", PType: "g", Added: [][]string{{"bob", "writer"}}, Removed: [][]string{{"bob", "reader"}}},
+		{Section: "g", PType: "g2", Added: [][]string{{"carol", "auditor"}}},
+		{Section: "p", PType: "p", Added: [][]string{{"writer", "/api/*", "POST"}}},
+		{Section: "p", PType: "p2", Removed: [][]string{{"auditor", "/audit"}}},
+	}, changes)
+
+	added, removed := changes.Counts()
+	assert.Equal(t, 3, added)
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, `- g, bob, reader
++ g, bob, writer
++ g2, carol, auditor
++ p, writer, /api/*, POST
+- p2, auditor, /audit
+`, changes.String())
+
+	assert.True(t, Diff(to, to).Empty())
+}
+
+func TestApply(t *testing.T) {
+	m := newModel(t)
+	from, err := Load(m, stringAdapter.NewAdapter(fromPolicy))
+	assert.Nil(t, err)
+	to, err := Load(m, stringAdapter.NewAdapter(toPolicy))
+	assert.Nil(t, err)
+	changes := Diff(from, to)
+
+	enforcer, err := casbinV2.NewSyncedEnforcer(newModel(t), stringAdapter.NewAdapter(fromPolicy))
+	assert.Nil(t, err)
+	enforcer.EnableAutoSave(false)
+
+	assert.Nil(t, changes.Apply(EnforcerTarget(enforcer)))
+	applied := FromModel(enforcer.GetModel())
+	assert.True(t, Diff(applied, to).Empty())
+
+	allowed, err := enforcer.Enforce("bob", "/api/users", "POST")
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+}
+
+func TestApplyDrifted(t *testing.T) {
+	m := newModel(t)
+	changes := Changeset{
+		{Section: "p", PType: "p", Added: [][]string{{"b", "/y", "GET"}, {"c", "/z", "GET"}}, Removed: [][]string{{"a", "/x", "GET"}, {"d", "/w", "GET"}}},
+	}
+
+	// the target has a rule to add already and misses a rule to remove
+	enforcer, err := casbinV2.NewSyncedEnforcer(m, stringAdapter.NewAdapter("p, b, /y, GET\np, a, /x, GET"))
+	assert.Nil(t, err)
+	enforcer.EnableAutoSave(false)
+
+	planned, err := changes.Plan(EnforcerTarget(enforcer))
+	assert.Nil(t, err)
+	assert.Equal(t, Changeset{
+		{Section: "p", PType: "p", Added: [][]string{{"c", "/z", "GET"}}, Removed: [][]string{{"a", "/x", "GET"}}},
+	}, planned)
+	// adapters apply every change
+	planned, err = changes.Plan(AdapterTarget(stringAdapter.NewAdapter("")))
+	assert.Nil(t, err)
+	assert.Equal(t, changes, planned)
+
+	assert.Nil(t, changes.Apply(EnforcerTarget(enforcer)))
+	planned, err = changes.Plan(EnforcerTarget(enforcer))
+	assert.Nil(t, err)
+	assert.True(t, planned.Empty())
+	policies, _ := enforcer.GetPolicy()
+	assert.Equal(t, [][]string{{"b", "/y", "GET"}, {"c", "/z", "GET"}}, policies)
+}
+
+type recordingAdapter struct {
+	*stringAdapter.Adapter
+	added, removed [][]string
+}
+
+func (a *recordingAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	a.added = append(a.added, append([]string{ptype}, rule...))
+	return nil
+}
+
+func (a *recordingAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	a.removed = append(a.removed, append([]string{ptype}, rule...))
+	return nil
+}
+
+func TestAdapterTarget(t *testing.T) {
+	m := newModel(t)
+	from, err := Load(m, stringAdapter.NewAdapter(fromPolicy))
+	assert.Nil(t, err)
+	to, err := Load(m, stringAdapter.NewAdapter(toPolicy))
+	assert.Nil(t, err)
+
+	a := &recordingAdapter{Adapter: stringAdapter.NewAdapter("")}
+	assert.Nil(t, Diff(from, to).Apply(AdapterTarget(a)))
+	assert.Equal(t, [][]string{
+		{"g", "bob", "writer"},
+		{"g2", "carol", "auditor"},
+		{"p", "writer", "/api/*", "POST"},
+	}, a.added)
+	assert.Equal(t, [][]string{
+		{"g", "bob", "reader"},
+		{"p2", "auditor", "/audit"},
+	}, a.removed)
+}
+
+func TestCopyModel(t *testing.T) {
+	m, err := model.NewModelFromString(strings.Replace(modelConfig, "g = _, _", "g = _, _, (_, _)", 1))
+	assert.Nil(t, err)
+	// casbin loads the policy into a copy of the model
+	enforcer, err := casbinV2.NewEnforcer(m, stringAdapter.NewAdapter("g, bob, reader, 2099-01-01 00:00:00, _"))
+	assert.Nil(t, err)
+	assert.Empty(t, enforcer.GetModel()["g"]["g"].ParamsTokens)
+
+	copied := CopyModel(enforcer.GetModel())
+	assert.Len(t, copied["g"]["g"].ParamsTokens, 2)
+	assert.Equal(t, [][]string{{"bob", "reader", "2099-01-01 00:00:00", "_"}}, copied["g"]["g"].Policy)
+	assert.Empty(t, CopyModel(newModel(t))["g"]["g"].ParamsTokens)
+}
@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// Sources of policy change events.
+const (
+	SourceCommit  = "commit"
+	SourceRestore = "restore"
+	SourceReload  = "reload"
+	SourceExpiry  = "expiry"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+var ErrPublisherFull = errors.New("policy: publisher buffer is full")
+
+// Event describes applied policy changes.
+type Event struct {
+	Source  string    `json:"source"`
+	Time    time.Time `json:"time"`
+	Changes Changeset `json:"changes"`
+}
+
+// Publisher notifies downstream consumers of policy changes.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// PublisherFunc is an adapter to allow the use of ordinary functions as Publisher.
+type PublisherFunc func(ctx context.Context, event Event) error
+
+// Publish calls f(ctx, event).
+func (f PublisherFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// Publishers publishes to every publisher.
+type Publishers []Publisher
+
+// Publish publishes the event to every publisher, joining their errors.
+func (p Publishers) Publish(ctx context.Context, event Event) error {
+	var errs []error
+	for _, publisher := range p {
+		if err := publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publish publishes the changes, logging failures as the changes are already applied.
+func (p Publishers) publish(ctx context.Context, source string, changes Changeset) {
+	if len(p) == 0 {
+		return
+	}
+	event := Event{Source: source, Time: time.Now(), Changes: changes}
+	if err := p.Publish(ctx, event); err != nil {
+		log.Errorf("policy: publish %s event: %v", source, err)
+	}
+}
+
+// ChannelPublisher delivers events on a buffered channel without blocking the
+// publisher, events are rejected with ErrPublisherFull when the buffer is full.
+type ChannelPublisher struct {
+	events chan Event
+}
+
+// NewChannelPublisher create a publisher buffering up to size events.
+func NewChannelPublisher(size int) *ChannelPublisher {
+	return &ChannelPublisher{events: make(chan Event, size)}
+}
+
+// Events returns the channel of the published events.
+func (p *ChannelPublisher) Events() <-chan Event {
+	return p.events
+}
+
+// Publish queues the event.
+func (p *ChannelPublisher) Publish(_ context.Context, event Event) error {
+	select {
+	case p.events <- event:
+		return nil
+	default:
+		return ErrPublisherFull
+	}
+}
+
+// WebhookOption is a webhook publisher option.
+type WebhookOption func(*WebhookPublisher)
+
+// WithWebhookClient send the events with the client
+func WithWebhookClient(client *http.Client) WebhookOption {
+	return func(p *WebhookPublisher) {
+		p.client = client
+	}
+}
+
+// WithWebhookHeader add a header to every request, e.g. for authentication
+func WithWebhookHeader(key, value string) WebhookOption {
+	return func(p *WebhookPublisher) {
+		p.header.Add(key, value)
+	}
+}
+
+// WebhookPublisher posts events as JSON to a URL.
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+	header http.Header
+}
+
+// NewWebhookPublisher create a publisher posting to the URL.
+func NewWebhookPublisher(url string, opts ...WebhookOption) *WebhookPublisher {
+	p := &WebhookPublisher{
+		url:    url,
+		client: &http.Client{Timeout: defaultWebhookTimeout},
+		header: make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Publish posts the event, failing on a non-2xx response.
+func (p *WebhookPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range p.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("policy: webhook %s: %s", p.url, resp.Status)
+	}
+	return nil
+}
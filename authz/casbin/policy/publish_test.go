@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelPublisher(t *testing.T) {
+	enforcer, _ := newTxEnforcer(t)
+	publisher := NewChannelPublisher(1)
+
+	_, err := Begin(enforcer, WithPublisher(publisher)).Add("g", "alice", "reader").Commit()
+	assert.Nil(t, err)
+
+	event := <-publisher.Events()
+	assert.Equal(t, SourceCommit, event.Source)
+	assert.Equal(t, Changeset{{Section: "g", PType: "g", Added: [][]string{{"alice", "reader"}}}}, event.Changes)
+
+	// a transaction changing nothing publishes nothing
+	_, err = Begin(enforcer, WithPublisher(publisher)).Add("g", "alice", "reader").Commit()
+	assert.Nil(t, err)
+	assert.Len(t, publisher.Events(), 0)
+
+	assert.Nil(t, publisher.Publish(context.Background(), Event{}))
+	assert.Equal(t, ErrPublisherFull, publisher.Publish(context.Background(), Event{}))
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	var (
+		received Event
+		token    string
+		status   = http.StatusNoContent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("Authorization")
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		received = Event{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	enforcer, _ := newTxEnforcer(t)
+	publisher := NewWebhookPublisher(srv.URL, WithWebhookHeader("Authorization", "Bearer secret"))
+
+	ctx := context.Background()
+	snapshots := NewSnapshots(enforcer, NewFileSnapshotStore(t.TempDir()), WithPublisher(publisher))
+	snapshot, err := snapshots.Take(ctx)
+	assert.Nil(t, err)
+
+	_, err = Begin(enforcer, WithPublisher(publisher)).Remove("g", "bob", "reader").Commit()
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer secret", token)
+	assert.Equal(t, SourceCommit, received.Source)
+	assert.Equal(t, Changeset{{Section: "g", PType: "g", Removed: [][]string{{"bob", "reader"}}}}, received.Changes)
+
+	_, err = snapshots.Restore(ctx, snapshot.Version)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceRestore, received.Source)
+	assert.Equal(t, Changeset{{Section: "g", PType: "g", Added: [][]string{{"bob", "reader"}}}}, received.Changes)
+
+	status = http.StatusInternalServerError
+	err = publisher.Publish(ctx, Event{Source: SourceCommit})
+	assert.EqualError(t, err, "policy: webhook "+srv.URL+": 500 Internal Server Error")
+}
@@ -0,0 +1,231 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+)
+
+var ErrSnapshotNotFound = errors.New("policy: snapshot not found")
+
+const snapshotVersionLayout = "20060102T150405.000000000Z"
+
+// Snapshot is the policy of an enforcer at a point in time.
+type Snapshot struct {
+	Version string    `json:"version"`
+	Time    time.Time `json:"time"`
+	Rules   Rules     `json:"rules,omitempty"`
+}
+
+// SnapshotStore persists snapshots.
+type SnapshotStore interface {
+	SaveSnapshot(ctx context.Context, snapshot *Snapshot) error
+	LoadSnapshot(ctx context.Context, version string) (*Snapshot, error)
+	// ListSnapshots returns the snapshots, oldest first, without their rules.
+	ListSnapshots(ctx context.Context) ([]*Snapshot, error)
+}
+
+// FileSnapshotStore stores snapshots as JSON files in a directory.
+type FileSnapshotStore struct {
+	dir string
+}
+
+// NewFileSnapshotStore create a store in the directory, created on first save.
+func NewFileSnapshotStore(dir string) *FileSnapshotStore {
+	return &FileSnapshotStore{dir: dir}
+}
+
+func (s *FileSnapshotStore) path(version string) string {
+	return filepath.Join(s.dir, version+".json")
+}
+
+// SaveSnapshot writes the snapshot atomically.
+func (s *FileSnapshotStore) SaveSnapshot(_ context.Context, snapshot *Snapshot) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(s.dir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(snapshot.Version))
+}
+
+// LoadSnapshot reads a snapshot, ErrSnapshotNotFound when there is none.
+func (s *FileSnapshotStore) LoadSnapshot(_ context.Context, version string) (*Snapshot, error) {
+	if version == "" || strings.ContainsAny(version, `/\`) {
+		return nil, ErrSnapshotNotFound
+	}
+	data, err := os.ReadFile(s.path(version))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+	if err = json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// ListSnapshots returns the snapshots of the directory, oldest first.
+func (s *FileSnapshotStore) ListSnapshots(ctx context.Context) ([]*Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		snapshot, err := s.LoadSnapshot(ctx, strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Rules = nil
+		snapshots = append(snapshots, snapshot)
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+func sortSnapshots(snapshots []*Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if !snapshots[i].Time.Equal(snapshots[j].Time) {
+			return snapshots[i].Time.Before(snapshots[j].Time)
+		}
+		return snapshots[i].Version < snapshots[j].Version
+	})
+}
+
+// Snapshots takes and restores snapshots of the policy of an enforcer.
+type Snapshots struct {
+	enforcer *casbinV2.SyncedEnforcer
+	store    SnapshotStore
+	opts     []TxOption
+	now      func() time.Time
+}
+
+// NewSnapshots manage the snapshots of the enforcer in the store. Restores
+// are committed as transactions with the options.
+func NewSnapshots(enforcer *casbinV2.SyncedEnforcer, store SnapshotStore, opts ...TxOption) *Snapshots {
+	return &Snapshots{
+		enforcer: enforcer,
+		store:    store,
+		opts:     opts,
+		now:      time.Now,
+	}
+}
+
+// Take snapshots the in-memory policy of the enforcer.
+func (s *Snapshots) Take(ctx context.Context) (*Snapshot, error) {
+	lock := s.enforcer.GetLock()
+	lock.RLock()
+	rules := FromModel(s.enforcer.GetModel())
+	lock.RUnlock()
+
+	now := s.now().UTC()
+	snapshot := &Snapshot{
+		Version: now.Format(snapshotVersionLayout),
+		Time:    now,
+		Rules:   rules,
+	}
+	if err := s.store.SaveSnapshot(ctx, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// List returns the snapshots, oldest first, without their rules.
+func (s *Snapshots) List(ctx context.Context) ([]*Snapshot, error) {
+	return s.store.ListSnapshots(ctx)
+}
+
+// Before returns the latest snapshot taken at or before t.
+func (s *Snapshots) Before(ctx context.Context, t time.Time) (*Snapshot, error) {
+	snapshots, err := s.store.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if !snapshots[i].Time.After(t) {
+			return s.store.LoadSnapshot(ctx, snapshots[i].Version)
+		}
+	}
+	return nil, ErrSnapshotNotFound
+}
+
+// Diff returns the changes between two snapshots, an empty version standing
+// for the live policy of the enforcer.
+func (s *Snapshots) Diff(ctx context.Context, from, to string) (Changeset, error) {
+	fromRules, err := s.rules(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	toRules, err := s.rules(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(fromRules, toRules), nil
+}
+
+func (s *Snapshots) rules(ctx context.Context, version string) (Rules, error) {
+	if version == "" {
+		lock := s.enforcer.GetLock()
+		lock.RLock()
+		defer lock.RUnlock()
+		return FromModel(s.enforcer.GetModel()), nil
+	}
+	snapshot, err := s.store.LoadSnapshot(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Rules, nil
+}
+
+// Restore brings the enforcer and its adapter back to the snapshot, applying
+// only the differences; on failure the changes already applied are reverted.
+func (s *Snapshots) Restore(ctx context.Context, version string) (Changeset, error) {
+	snapshot, err := s.store.LoadSnapshot(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := Begin(s.enforcer, s.opts...)
+	tx.source = SourceRestore
+	tx.ctx = ctx
+	tx.reset = true
+	for ptype, rules := range snapshot.Rules {
+		tx.added[ptype] = rules
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	enforcer, a := newTxEnforcer(t)
+	store := NewFileSnapshotStore(t.TempDir())
+	snapshots := NewSnapshots(enforcer, store)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snapshots.now = func() time.Time { return now }
+
+	first, err := snapshots.Take(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "20240501T120000.000000000Z", first.Version)
+
+	_, err = Begin(enforcer).
+		Remove("g", "bob", "reader").
+		Add("g", "bob", "writer").
+		Commit()
+	assert.Nil(t, err)
+
+	now = now.Add(time.Hour)
+	second, err := snapshots.Take(ctx)
+	assert.Nil(t, err)
+
+	list, err := snapshots.List(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []*Snapshot{
+		{Version: first.Version, Time: first.Time},
+		{Version: second.Version, Time: second.Time},
+	}, list)
+
+	changes, err := snapshots.Diff(ctx, first.Version, second.Version)
+	assert.Nil(t, err)
+	assert.Equal(t, Changeset{
+		{Section: "g", PType: "g", Added: [][]string{{"bob", "writer"}}, Removed: [][]string{{"bob", "reader"}}},
+	}, changes)
+
+	found, err := snapshots.Before(ctx, now.Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, first.Version, found.Version)
+	_, err = snapshots.Before(ctx, now.Add(-2*time.Hour))
+	assert.Equal(t, ErrSnapshotNotFound, err)
+
+	changes, err = snapshots.Restore(ctx, first.Version)
+	assert.Nil(t, err)
+	assert.False(t, changes.Empty())
+	assert.True(t, Diff(first.Rules, FromModel(enforcer.GetModel())).Empty())
+	assert.True(t, Diff(first.Rules, a.rules).Empty())
+
+	changes, err = snapshots.Diff(ctx, first.Version, "")
+	assert.Nil(t, err)
+	assert.True(t, changes.Empty())
+
+	_, err = snapshots.Restore(ctx, "missing")
+	assert.Equal(t, ErrSnapshotNotFound, err)
+}
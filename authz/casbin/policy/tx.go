@@ -0,0 +1,379 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/persist"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policytest"
+)
+
+var (
+	ErrTxDone   = errors.New("policy: transaction has already been committed or rolled back")
+	ErrTxStaged = errors.New("policy: transaction has already been staged")
+)
+
+// Validator checks the policy a transaction is about to commit. The enforcer
+// holds the resulting model and policy, it is discarded afterwards.
+type Validator func(candidate *casbinV2.Enforcer) error
+
+// SuiteValidator rejects a policy failing a case of the policy test suite.
+func SuiteValidator(suite *policytest.Suite) Validator {
+	return func(candidate *casbinV2.Enforcer) error {
+		failed := policytest.Failed(suite.Run(candidate))
+		if len(failed) == 0 {
+			return nil
+		}
+		messages := make([]string, len(failed))
+		for i, result := range failed {
+			messages[i] = result.Case.String()
+		}
+		return fmt.Errorf("%d policy test(s) failed: %s", len(failed), strings.Join(messages, "; "))
+	}
+}
+
+// TxOption is a transaction option.
+type TxOption func(*Tx)
+
+// WithValidator validate the resulting policy before committing
+func WithValidator(validators ...Validator) TxOption {
+	return func(tx *Tx) {
+		tx.validators = append(tx.validators, validators...)
+	}
+}
+
+// WithPublisher publish the committed changes
+func WithPublisher(publishers ...Publisher) TxOption {
+	return func(tx *Tx) {
+		tx.publishers = append(tx.publishers, publishers...)
+	}
+}
+
+// WithSource set the source of the published events, SourceCommit by default
+func WithSource(source string) TxOption {
+	return func(tx *Tx) {
+		tx.source = source
+	}
+}
+
+// WithCandidateSetup set up the enforcers built to validate the resulting
+// policy, e.g. with the custom functions and matching functions of the
+// enforcer which are not carried over
+func WithCandidateSetup(setups ...func(candidate *casbinV2.Enforcer) error) TxOption {
+	return func(tx *Tx) {
+		tx.setups = append(tx.setups, setups...)
+	}
+}
+
+// WithCommitHook run the hooks under the enforcer lock once the changes are
+// applied, or reverted, e.g. to register role link conditions
+func WithCommitHook(hooks ...func(e *casbinV2.Enforcer)) TxOption {
+	return func(tx *Tx) {
+		tx.hooks = append(tx.hooks, hooks...)
+	}
+}
+
+// Tx batches policy changes to apply them atomically to the enforcer and its
+// adapter. It is not safe for concurrent use.
+type Tx struct {
+	enforcer   *casbinV2.SyncedEnforcer
+	validators []Validator
+	publishers Publishers
+	setups     []func(candidate *casbinV2.Enforcer) error
+	hooks      []func(e *casbinV2.Enforcer)
+	source     string
+	ctx        context.Context
+	added      Rules
+	removed    Rules
+	// reset replaces the current rules by added when set.
+	reset bool
+	// staged is set once the changes are stored by Stage.
+	staged bool
+	done   bool
+}
+
+// Begin starts a transaction on the enforcer.
+func Begin(enforcer *casbinV2.SyncedEnforcer, opts ...TxOption) *Tx {
+	tx := &Tx{
+		enforcer: enforcer,
+		source:   SourceCommit,
+		ctx:      context.Background(),
+		added:    make(Rules),
+		removed:  make(Rules),
+	}
+	for _, opt := range opts {
+		opt(tx)
+	}
+	return tx
+}
+
+// Add adds a rule of the policy type, such as "p" or "g".
+func (tx *Tx) Add(ptype string, rule ...string) *Tx {
+	tx.added[ptype] = append(tx.added[ptype], rule)
+	tx.removed[ptype] = without(tx.removed[ptype], rule)
+	return tx
+}
+
+// Remove removes a rule of the policy type, such as "p" or "g".
+func (tx *Tx) Remove(ptype string, rule ...string) *Tx {
+	tx.removed[ptype] = append(tx.removed[ptype], rule)
+	tx.added[ptype] = without(tx.added[ptype], rule)
+	return tx
+}
+
+func without(rules [][]string, rule []string) [][]string {
+	k := key(rule)
+	kept := rules[:0]
+	for _, r := range rules {
+		if key(r) != k {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// Rollback discards the pending changes.
+func (tx *Tx) Rollback() {
+	tx.done = true
+}
+
+// Commit validates the resulting policy and applies the changes to the
+// adapter and the in-memory model. When validation fails nothing is applied;
+// when the adapter fails the changes already applied are reverted. After
+// Stage, only the in-memory model is updated. The applied changes are
+// published once the enforcer is unlocked.
+func (tx *Tx) Commit() (Changeset, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	tx.done = true
+
+	changes, err := tx.commit()
+	if err == nil && !changes.Empty() {
+		tx.publishers.publish(tx.ctx, tx.source, changes)
+	}
+	return changes, err
+}
+
+func (tx *Tx) commit() (Changeset, error) {
+	lock := tx.enforcer.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	e := tx.enforcer.Enforcer
+	current := FromModel(e.GetModel())
+	changes := Diff(current, tx.apply(current))
+	if changes.Empty() {
+		return nil, nil
+	}
+
+	if tx.staged {
+		// the changes are already stored, only the in-memory policy is updated
+		adapter := e.GetAdapter()
+		e.SetAdapter(nil)
+		defer e.SetAdapter(adapter)
+	} else if err := tx.validate(e, changes); err != nil {
+		return nil, err
+	}
+
+	err := commit(e, changes)
+	for _, hook := range tx.hooks {
+		hook(e)
+	}
+	return changes, err
+}
+
+func (tx *Tx) validate(e *casbinV2.Enforcer, changes Changeset) error {
+	if len(tx.validators) == 0 {
+		return nil
+	}
+	candidate, err := tx.candidate(e, changes)
+	if err != nil {
+		return fmt.Errorf("policy: build candidate: %w", err)
+	}
+	for _, validate := range tx.validators {
+		if err = validate(candidate); err != nil {
+			return fmt.Errorf("policy: validate: %w", err)
+		}
+	}
+	return nil
+}
+
+// Stage validates the changes and writes them through the adapter, typically
+// bound to a database transaction shared with other data, leaving the
+// enforcer unchanged. Once that transaction committed, Commit applies the
+// changes to the in-memory policy only; otherwise call Rollback. The
+// transaction must not be changed after Stage.
+func (tx *Tx) Stage(adapter persist.Adapter) (Changeset, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	if tx.staged {
+		return nil, ErrTxStaged
+	}
+
+	changes, err := tx.stage()
+	if err != nil {
+		return nil, err
+	}
+	if err = changes.Apply(AdapterTarget(adapter)); err != nil {
+		return nil, fmt.Errorf("policy: stage: %w", err)
+	}
+	tx.staged = true
+	return changes, nil
+}
+
+func (tx *Tx) stage() (Changeset, error) {
+	lock := tx.enforcer.GetLock()
+	lock.RLock()
+	defer lock.RUnlock()
+
+	e := tx.enforcer.Enforcer
+	current := FromModel(e.GetModel())
+	changes := Diff(current, tx.apply(current))
+	if changes.Empty() {
+		return nil, nil
+	}
+	return changes, tx.validate(e, changes)
+}
+
+// apply returns the rules resulting from the transaction.
+func (tx *Tx) apply(current Rules) Rules {
+	result := make(Rules, len(current))
+	if tx.reset {
+		current = nil
+	}
+	for ptype, rules := range current {
+		result[ptype] = subtract(rules, tx.removed[ptype])
+	}
+	for ptype, rules := range tx.added {
+		result[ptype] = append(result[ptype], rules...)
+	}
+	return result
+}
+
+// candidate builds an enforcer holding the model of e with the changes applied,
+// set up by the WithCandidateSetup functions as casbin does not expose the
+// functions of e.
+func (tx *Tx) candidate(e *casbinV2.Enforcer, changes Changeset) (*casbinV2.Enforcer, error) {
+	m := CopyModel(e.GetModel())
+	for _, change := range changes {
+		if _, err := m.RemovePoliciesWithAffected(change.Section, change.PType, change.Removed); err != nil {
+			return nil, err
+		}
+		if err := m.AddPolicies(change.Section, change.PType, change.Added); err != nil {
+			return nil, err
+		}
+	}
+
+	candidate, err := casbinV2.NewEnforcer(m)
+	if err != nil {
+		return nil, err
+	}
+	if err = candidate.BuildRoleLinks(); err != nil {
+		return nil, err
+	}
+	for _, setup := range tx.setups {
+		if err = setup(candidate); err != nil {
+			return nil, err
+		}
+	}
+	return candidate, nil
+}
+
+type step struct {
+	sec, ptype string
+	rules      [][]string
+	add        bool
+}
+
+func (s step) do(e *casbinV2.Enforcer) error {
+	if s.add {
+		return enforcerTarget{e}.AddPolicies(s.sec, s.ptype, s.rules)
+	}
+	return enforcerTarget{e}.RemovePolicies(s.sec, s.ptype, s.rules)
+}
+
+// batchAdapter lets casbin persist batches to adapters without batch methods,
+// it asserts persist.BatchAdapter when auto-save is enabled. The rules of a
+// failed batch already written are undone, so that it fails as a whole.
+type batchAdapter struct {
+	persist.Adapter
+}
+
+func (a batchAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	return a.batch(sec, ptype, rules, a.AddPolicy, a.RemovePolicy)
+}
+
+func (a batchAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return a.batch(sec, ptype, rules, a.RemovePolicy, a.AddPolicy)
+}
+
+func (a batchAdapter) batch(sec string, ptype string, rules [][]string, do, undo func(string, string, []string) error) error {
+	for i, rule := range rules {
+		err := do(sec, ptype, rule)
+		if err == nil {
+			continue
+		}
+
+		var undoErrs []error
+		for j := i - 1; j >= 0; j-- {
+			if undoErr := undo(sec, ptype, rules[j]); undoErr != nil {
+				undoErrs = append(undoErrs, undoErr)
+			}
+		}
+		if len(undoErrs) > 0 {
+			return fmt.Errorf("%w, undo: %v", err, errors.Join(undoErrs...))
+		}
+		return err
+	}
+	return nil
+}
+
+// commit applies the changes, removals first, reverting the applied steps on
+// failure. The caller holds the enforcer lock.
+func commit(e *casbinV2.Enforcer, changes Changeset) error {
+	if adapter := e.GetAdapter(); adapter != nil {
+		if _, ok := adapter.(persist.BatchAdapter); !ok {
+			e.SetAdapter(batchAdapter{adapter})
+			defer e.SetAdapter(adapter)
+		}
+	}
+
+	var steps []step
+	for _, change := range changes {
+		if len(change.Removed) > 0 {
+			steps = append(steps, step{sec: change.Section, ptype: change.PType, rules: change.Removed})
+		}
+	}
+	for _, change := range changes {
+		if len(change.Added) > 0 {
+			steps = append(steps, step{sec: change.Section, ptype: change.PType, rules: change.Added, add: true})
+		}
+	}
+
+	for i, s := range steps {
+		err := s.do(e)
+		if err == nil {
+			continue
+		}
+
+		var rollbackErrs []error
+		for j := i - 1; j >= 0; j-- {
+			undo := steps[j]
+			undo.add = !undo.add
+			if rbErr := undo.do(e); rbErr != nil {
+				rollbackErrs = append(rollbackErrs, rbErr)
+			}
+		}
+		if len(rollbackErrs) > 0 {
+			return fmt.Errorf("policy: commit: %w, rollback: %v", err, errors.Join(rollbackErrs...))
+		}
+		return fmt.Errorf("policy: commit: %w", err)
+	}
+	return nil
+}
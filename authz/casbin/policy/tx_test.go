@@ -0,0 +1,226 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policytest"
+)
+
+var errAdapter = errors.New("adapter failure")
+
+// memoryAdapter is a batch adapter keeping the rules in memory.
+type memoryAdapter struct {
+	rules    Rules
+	failAdds int
+}
+
+func (a *memoryAdapter) LoadPolicy(m model.Model) error {
+	for _, ptype := range a.rules.PTypes() {
+		for _, rule := range a.rules[ptype] {
+			if err := persist.LoadPolicyArray(append([]string{ptype}, rule...), m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *memoryAdapter) SavePolicy(m model.Model) error {
+	a.rules = FromModel(m)
+	return nil
+}
+
+func (a *memoryAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.AddPolicies(sec, ptype, [][]string{rule})
+}
+
+func (a *memoryAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemovePolicies(sec, ptype, [][]string{rule})
+}
+
+func (a *memoryAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return errors.New("not implemented")
+}
+
+func (a *memoryAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	if a.failAdds > 0 {
+		a.failAdds--
+		return errAdapter
+	}
+	a.rules[ptype] = append(a.rules[ptype], rules...)
+	return nil
+}
+
+func (a *memoryAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	a.rules[ptype] = subtract(a.rules[ptype], rules)
+	return nil
+}
+
+func newTxEnforcer(t *testing.T) (*casbinV2.SyncedEnforcer, *memoryAdapter) {
+	a := &memoryAdapter{rules: Rules{
+		"p": {{"reader", "/api/*", "GET"}},
+		"g": {{"bob", "reader"}},
+	}}
+	enforcer, err := casbinV2.NewSyncedEnforcer(newModel(t), a)
+	assert.Nil(t, err)
+	return enforcer, a
+}
+
+func TestTxCommit(t *testing.T) {
+	enforcer, a := newTxEnforcer(t)
+
+	changes, err := Begin(enforcer).
+		Add("p", "writer", "/api/*", "POST").
+		Add("g", "bob", "writer").
+		Remove("g", "bob", "reader").
+		Add("p", "reader", "/api/*", "GET").
+		Commit()
+	assert.Nil(t, err)
+	added, removed := changes.Counts()
+	assert.Equal(t, 2, added)
+	assert.Equal(t, 1, removed)
+
+	allowed, _ := enforcer.Enforce("bob", "/api/users", "POST")
+	assert.True(t, allowed)
+	allowed, _ = enforcer.Enforce("bob", "/api/users", "GET")
+	assert.False(t, allowed)
+	assert.True(t, Diff(a.rules, FromModel(enforcer.GetModel())).Empty())
+}
+
+func TestTxCommitSingleAdapter(t *testing.T) {
+	a := &memoryAdapter{rules: Rules{"g": {{"bob", "reader"}}}}
+	// only the persist.Adapter methods, casbin asserts persist.BatchAdapter with auto-save
+	enforcer, err := casbinV2.NewSyncedEnforcer(newModel(t), struct{ persist.Adapter }{a})
+	assert.Nil(t, err)
+
+	_, err = Begin(enforcer).
+		Add("p", "writer", "/api/*", "POST").
+		Add("g", "bob", "writer").
+		Remove("g", "bob", "reader").
+		Commit()
+	assert.Nil(t, err)
+	assert.True(t, Diff(a.rules, FromModel(enforcer.GetModel())).Empty())
+	_, ok := enforcer.GetAdapter().(struct{ persist.Adapter })
+	assert.True(t, ok)
+}
+
+// singleAdapter only has the persist.Adapter methods, failing the add number
+// failAdd.
+type singleAdapter struct {
+	*memoryAdapter
+	adds, failAdd int
+}
+
+func (a *singleAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	if a.adds++; a.adds == a.failAdd {
+		return errAdapter
+	}
+	return a.memoryAdapter.AddPolicy(sec, ptype, rule)
+}
+
+func TestTxRollbackSingleAdapterBatch(t *testing.T) {
+	a := &singleAdapter{memoryAdapter: &memoryAdapter{rules: Rules{"g": {{"bob", "reader"}}}}, failAdd: 2}
+	enforcer, err := casbinV2.NewSyncedEnforcer(newModel(t), struct{ persist.Adapter }{a})
+	assert.Nil(t, err)
+	before := FromModel(enforcer.GetModel())
+
+	// the second rule of the batch fails
+	_, err = Begin(enforcer).
+		Remove("g", "bob", "reader").
+		Add("p", "x", "/1", "GET").
+		Add("p", "y", "/2", "GET").
+		Commit()
+	assert.ErrorIs(t, err, errAdapter)
+
+	assert.True(t, Diff(before, FromModel(enforcer.GetModel())).Empty())
+	assert.True(t, Diff(before, a.rules).Empty())
+}
+
+func TestTxRollbackOnAdapterFailure(t *testing.T) {
+	enforcer, a := newTxEnforcer(t)
+	before := FromModel(enforcer.GetModel())
+	a.failAdds = 1
+
+	_, err := Begin(enforcer).
+		Remove("g", "bob", "reader").
+		Add("g", "bob", "writer").
+		Commit()
+	assert.ErrorIs(t, err, errAdapter)
+
+	assert.True(t, Diff(before, FromModel(enforcer.GetModel())).Empty())
+	assert.True(t, Diff(before, a.rules).Empty())
+	allowed, _ := enforcer.Enforce("bob", "/api/users", "GET")
+	assert.True(t, allowed)
+}
+
+func TestTxValidator(t *testing.T) {
+	enforcer, a := newTxEnforcer(t)
+	suite := &policytest.Suite{Cases: []policytest.Case{
+		{Subject: "bob", Object: "/api/users", Action: "GET", Expect: policytest.ExpectAllow},
+	}}
+
+	_, err := Begin(enforcer, WithValidator(SuiteValidator(suite))).
+		Remove("g", "bob", "reader").
+		Commit()
+	assert.EqualError(t, err, "policy: validate: 1 policy test(s) failed: bob can GET /api/users")
+	assert.Equal(t, [][]string{{"bob", "reader"}}, a.rules["g"])
+	has, _ := enforcer.HasGroupingPolicy("bob", "reader")
+	assert.True(t, has)
+
+	_, err = Begin(enforcer, WithValidator(SuiteValidator(suite))).
+		Add("g", "bob", "writer").
+		Commit()
+	assert.Nil(t, err)
+	has, _ = enforcer.HasGroupingPolicy("bob", "writer")
+	assert.True(t, has)
+}
+
+func TestTxDone(t *testing.T) {
+	enforcer, _ := newTxEnforcer(t)
+
+	tx := Begin(enforcer).Add("g", "alice", "reader")
+	tx.Rollback()
+	_, err := tx.Commit()
+	assert.Equal(t, ErrTxDone, err)
+	has, _ := enforcer.HasGroupingPolicy("alice", "reader")
+	assert.False(t, has)
+}
+
+func TestTxStage(t *testing.T) {
+	enforcer, a := newTxEnforcer(t)
+	// stands for an adapter bound to a database transaction
+	staging := &memoryAdapter{rules: Rules{}}
+
+	tx := Begin(enforcer).Add("g", "alice", "reader").Remove("g", "bob", "reader")
+	changes, err := tx.Stage(staging)
+	assert.Nil(t, err)
+	assert.False(t, changes.Empty())
+	assert.Equal(t, [][]string{{"alice", "reader"}}, staging.rules["g"])
+	has, _ := enforcer.HasGroupingPolicy("alice", "reader")
+	assert.False(t, has)
+	_, err = tx.Stage(staging)
+	assert.Equal(t, ErrTxStaged, err)
+
+	// once the database transaction committed
+	_, err = tx.Commit()
+	assert.Nil(t, err)
+	has, _ = enforcer.HasGroupingPolicy("alice", "reader")
+	assert.True(t, has)
+	has, _ = enforcer.HasGroupingPolicy("bob", "reader")
+	assert.False(t, has)
+	// the adapter of the enforcer is not written again
+	assert.Equal(t, [][]string{{"bob", "reader"}}, a.rules["g"])
+	assert.Equal(t, a, enforcer.GetAdapter())
+
+	failed := Begin(enforcer, WithValidator(func(*casbinV2.Enforcer) error { return errAdapter })).Add("g", "carol", "reader")
+	_, err = failed.Stage(staging)
+	assert.ErrorIs(t, err, errAdapter)
+	assert.Len(t, staging.rules["g"], 1)
+}
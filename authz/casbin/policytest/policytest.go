@@ -0,0 +1,244 @@
+package policytest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ExpectAllow = "allow"
+	ExpectDeny  = "deny"
+)
+
+// Enforcer is the part of the casbin enforcer used to run the cases.
+type Enforcer interface {
+	GetModel() model.Model
+	EnforceEx(rvals ...interface{}) (bool, []string, error)
+	GetImplicitRolesForUser(name string, domain ...string) ([]string, error)
+}
+
+// Suite is a set of expectations on a model and policy, usually loaded from YAML:
+//
+//	model: authz_model.conf
+//	policy: authz_policy.csv
+//	cases:
+//	  - name: cathy administers dataset1
+//	    subject: cathy
+//	    object: /dataset1/x
+//	    action: POST
+//	    expect: allow
+//	  - subject: bob
+//	    domain: tenant1
+//	    object: /dataset1/x
+//	    action: POST
+//	    expect: deny
+//
+// Model and policy paths are relative to the suite file.
+type Suite struct {
+	Model  string `yaml:"model" json:"model"`
+	Policy string `yaml:"policy" json:"policy"`
+	Cases  []Case `yaml:"cases" json:"cases"`
+}
+
+// Case is a single expectation.
+type Case struct {
+	Name    string `yaml:"name" json:"name,omitempty"`
+	Subject string `yaml:"subject" json:"subject"`
+	Domain  string `yaml:"domain" json:"domain,omitempty"`
+	Object  string `yaml:"object" json:"object"`
+	Action  string `yaml:"action" json:"action"`
+	Expect  string `yaml:"expect" json:"expect"`
+}
+
+func (c Case) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	var verb = "can"
+	if c.Expect == ExpectDeny {
+		verb = "cannot"
+	}
+	if c.Domain != "" {
+		return fmt.Sprintf("%s %s %s %s in %s", c.Subject, verb, c.Action, c.Object, c.Domain)
+	}
+	return fmt.Sprintf("%s %s %s %s", c.Subject, verb, c.Action, c.Object)
+}
+
+// Result is the outcome of a case.
+type Result struct {
+	Case    Case     `json:"case"`
+	Passed  bool     `json:"passed"`
+	Allowed bool     `json:"allowed"`
+	Explain []string `json:"explain,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func (r Result) String() string {
+	status := "PASS"
+	if !r.Passed {
+		status = "FAIL"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s", status, r.Case)
+	if r.Error != "" {
+		fmt.Fprintf(&sb, "\n\terror: %s", r.Error)
+	}
+	if !r.Passed {
+		fmt.Fprintf(&sb, "\n\texpected %s, got allowed=%t", r.Case.Expect, r.Allowed)
+		if len(r.Roles) > 0 {
+			fmt.Fprintf(&sb, "\n\troles: %s", strings.Join(r.Roles, ", "))
+		}
+		if len(r.Explain) > 0 {
+			fmt.Fprintf(&sb, "\n\tmatched rule: %s", strings.Join(r.Explain, ", "))
+		} else {
+			fmt.Fprintf(&sb, "\n\tmatched rule: none")
+		}
+	}
+	return sb.String()
+}
+
+// Load reads a suite from a YAML file, resolving its model and policy paths.
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	suite := &Suite{}
+	if err = yaml.Unmarshal(data, suite); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	if suite.Model != "" && !filepath.IsAbs(suite.Model) {
+		suite.Model = filepath.Join(dir, suite.Model)
+	}
+	if suite.Policy != "" && !filepath.IsAbs(suite.Policy) {
+		suite.Policy = filepath.Join(dir, suite.Policy)
+	}
+
+	for i, c := range suite.Cases {
+		if c.Expect != ExpectAllow && c.Expect != ExpectDeny {
+			return nil, fmt.Errorf("%s: case %d (%s): expect must be %s or %s", path, i+1, c, ExpectAllow, ExpectDeny)
+		}
+	}
+	return suite, nil
+}
+
+// NewEnforcer creates an enforcer from the model and policy of the suite.
+func (s *Suite) NewEnforcer() (*casbinV2.SyncedEnforcer, error) {
+	if s.Model == "" || s.Policy == "" {
+		return nil, fmt.Errorf("suite has no model or policy")
+	}
+	enforcer, err := casbinV2.NewSyncedEnforcer(s.Model, s.Policy)
+	if err != nil {
+		return nil, err
+	}
+	enforcer.EnableLog(false)
+	return enforcer, nil
+}
+
+// Run runs the cases against the enforcer. The domain of a case is passed
+// when the request definition of the model has four fields.
+func (s *Suite) Run(enforcer Enforcer) []Result {
+	withDomain := false
+	if r, ok := enforcer.GetModel()["r"]["r"]; ok {
+		withDomain = len(r.Tokens) == 4
+	}
+	_, hasRoles := enforcer.GetModel()["g"]["g"]
+
+	results := make([]Result, 0, len(s.Cases))
+	for _, c := range s.Cases {
+		var request []interface{}
+		if withDomain {
+			request = []interface{}{c.Subject, c.Domain, c.Object, c.Action}
+		} else {
+			request = []interface{}{c.Subject, c.Object, c.Action}
+		}
+
+		result := Result{Case: c}
+		allowed, explain, err := enforcer.EnforceEx(request...)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Allowed = allowed
+			result.Explain = explain
+			result.Passed = allowed == (c.Expect == ExpectAllow)
+		}
+
+		if hasRoles {
+			if withDomain {
+				result.Roles, _ = enforcer.GetImplicitRolesForUser(c.Subject, c.Domain)
+			} else {
+				result.Roles, _ = enforcer.GetImplicitRolesForUser(c.Subject)
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// RunFile loads the suite and runs it against its own model and policy.
+func RunFile(path string) ([]Result, error) {
+	suite, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	enforcer, err := suite.NewEnforcer()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return suite.Run(enforcer), nil
+}
+
+// Failed returns the results which did not pass.
+func Failed(results []Result) []Result {
+	var failed []Result
+	for _, r := range results {
+		if !r.Passed {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// Test runs the suite file as subtests, against enforcer when given or against
+// the model and policy of the suite otherwise.
+func Test(t *testing.T, path string, enforcer ...Enforcer) {
+	t.Helper()
+
+	suite, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e Enforcer
+	if len(enforcer) > 0 {
+		e = enforcer[0]
+	} else {
+		se, err := suite.NewEnforcer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e = se
+	}
+
+	for _, result := range suite.Run(e) {
+		result := result
+		t.Run(result.Case.String(), func(t *testing.T) {
+			if !result.Passed {
+				t.Error(result)
+			}
+		})
+	}
+}
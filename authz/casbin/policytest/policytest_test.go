@@ -0,0 +1,57 @@
+package policytest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuites(t *testing.T) {
+	Test(t, "testdata/rbac.yaml")
+	Test(t, "testdata/domain.yaml")
+}
+
+func TestRunFile(t *testing.T) {
+	results, err := RunFile("testdata/failing.yaml")
+	assert.Nil(t, err)
+
+	failed := Failed(results)
+	if assert.Len(t, failed, 2) {
+		assert.True(t, failed[0].Allowed)
+		assert.Equal(t, []string{"dataset1_admin", "/dataset1/*", "*"}, failed[0].Explain)
+		assert.Equal(t, []string{"dataset1_admin"}, failed[0].Roles)
+		assert.True(t, strings.Contains(failed[0].String(), "matched rule: dataset1_admin, /dataset1/*, *"))
+
+		assert.False(t, failed[1].Allowed)
+		assert.Equal(t, "FAIL: bob can POST /dataset1/x\n\texpected allow, got allowed=false\n\tmatched rule: none", failed[1].String())
+	}
+}
+
+func TestRunWithEnforcer(t *testing.T) {
+	suite, err := Load("testdata/rbac.yaml")
+	assert.Nil(t, err)
+
+	enforcer, err := suite.NewEnforcer()
+	assert.Nil(t, err)
+	assert.Empty(t, Failed(suite.Run(enforcer)))
+
+	_, err = enforcer.DeleteRoleForUser("cathy", "dataset1_admin")
+	assert.Nil(t, err)
+	failed := Failed(suite.Run(enforcer))
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, "cathy", failed[0].Case.Subject)
+	}
+}
+
+func TestLoadInvalidExpect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("cases:\n  - subject: alice\n    object: /x\n    action: GET\n    expect: yes\n"), 0o644))
+
+	_, err := Load(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "expect must be allow or deny")
+	}
+}
@@ -0,0 +1,62 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// Broker publishes and subscribes messages on named channels.
+type Broker interface {
+	// Publish sends the data to the subscribers of the channel.
+	Publish(ctx context.Context, channel string, data []byte) error
+	// Subscribe calls handler with the data published on the channel until
+	// the returned function is called.
+	Subscribe(ctx context.Context, channel string, handler func(data []byte)) (unsubscribe func() error, err error)
+}
+
+// MemoryBroker is an in-process broker, for tests and single-process deployments.
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers map[string]map[int]func([]byte)
+	nextID   int
+}
+
+// NewMemoryBroker create an in-process broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{handlers: make(map[string]map[int]func([]byte))}
+}
+
+// Publish calls the handlers of the channel synchronously.
+func (b *MemoryBroker) Publish(_ context.Context, channel string, data []byte) error {
+	b.mu.RLock()
+	handlers := make([]func([]byte), 0, len(b.handlers[channel]))
+	for _, handler := range b.handlers[channel] {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(append([]byte(nil), data...))
+	}
+	return nil
+}
+
+// Subscribe registers the handler on the channel.
+func (b *MemoryBroker) Subscribe(_ context.Context, channel string, handler func([]byte)) (func() error, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	if b.handlers[channel] == nil {
+		b.handlers[channel] = make(map[int]func([]byte))
+	}
+	b.handlers[channel][id] = handler
+
+	return func() error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers[channel], id)
+		return nil
+	}, nil
+}
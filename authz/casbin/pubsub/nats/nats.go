@@ -0,0 +1,43 @@
+package nats
+
+import (
+	"context"
+
+	natsGo "github.com/nats-io/nats.go"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/pubsub"
+)
+
+var _ pubsub.Broker = (*Broker)(nil)
+
+// Broker is a pubsub.Broker on NATS core subjects.
+type Broker struct {
+	conn *natsGo.Conn
+}
+
+// NewBroker create a broker on the connection.
+func NewBroker(conn *natsGo.Conn) *Broker {
+	return &Broker{conn: conn}
+}
+
+// Publish publishes the data on the subject.
+func (b *Broker) Publish(_ context.Context, channel string, data []byte) error {
+	return b.conn.Publish(channel, data)
+}
+
+// Subscribe subscribes to the subject, the handler is called from the
+// subscription goroutine of the connection.
+func (b *Broker) Subscribe(_ context.Context, channel string, handler func([]byte)) (func() error, error) {
+	sub, err := b.conn.Subscribe(channel, func(msg *natsGo.Msg) {
+		handler(msg.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// make sure the server registered the subscription before returning
+	if err = b.conn.Flush(); err != nil {
+		_ = sub.Unsubscribe()
+		return nil, err
+	}
+	return sub.Unsubscribe, nil
+}
@@ -0,0 +1,55 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	natsGo "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin"
+	"github.com/tx7do/kratos-casbin/authz/casbin/pubsub"
+)
+
+func TestBroker(t *testing.T) {
+	url := os.Getenv("NATS_URL")
+	if url == "" {
+		t.Skip("NATS_URL not set")
+	}
+	conn, err := natsGo.Connect(url)
+	assert.Nil(t, err)
+	defer conn.Close()
+	broker := NewBroker(conn)
+
+	a, err := pubsub.NewWatcher(context.Background(), broker, pubsub.WithInstanceID("a"))
+	assert.Nil(t, err)
+	defer a.Close()
+	b, err := pubsub.NewWatcher(context.Background(), broker, pubsub.WithInstanceID("b"))
+	assert.Nil(t, err)
+	defer b.Close()
+
+	received := make(chan casbin.WatcherMessage, 1)
+	_ = b.SetUpdateCallback(func(msg string) {
+		var m casbin.WatcherMessage
+		assert.Nil(t, json.Unmarshal([]byte(msg), &m))
+		received <- m
+	})
+
+	assert.Nil(t, a.UpdateForRemoveFilteredPolicy("g", "g", 1, "admin"))
+	select {
+	case m := <-received:
+		assert.Equal(t, casbin.WatcherMessage{
+			Method:      casbin.WatcherUpdateForRemoveFilteredPolicy,
+			ID:          "a",
+			Sec:         "g",
+			Ptype:       "g",
+			FieldIndex:  1,
+			FieldValues: []string{"admin"},
+		}, m)
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+}
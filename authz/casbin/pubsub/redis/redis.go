@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"context"
+
+	goRedis "github.com/redis/go-redis/v9"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/pubsub"
+)
+
+var _ pubsub.Broker = (*Broker)(nil)
+
+// Broker is a pubsub.Broker on Redis pub/sub.
+type Broker struct {
+	client goRedis.UniversalClient
+}
+
+// NewBroker create a broker on the client.
+func NewBroker(client goRedis.UniversalClient) *Broker {
+	return &Broker{client: client}
+}
+
+// Publish publishes the data on the Redis channel.
+func (b *Broker) Publish(ctx context.Context, channel string, data []byte) error {
+	return b.client.Publish(ctx, channel, data).Err()
+}
+
+// Subscribe subscribes to the Redis channel, the handler is called from a
+// dedicated goroutine.
+func (b *Broker) Subscribe(ctx context.Context, channel string, handler func([]byte)) (func() error, error) {
+	sub := b.client.Subscribe(ctx, channel)
+	// wait for the subscription to be confirmed so no message is missed
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range sub.Channel() {
+			handler([]byte(msg.Payload))
+		}
+	}()
+
+	return func() error {
+		err := sub.Close()
+		<-done
+		return err
+	}, nil
+}
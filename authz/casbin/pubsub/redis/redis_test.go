@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goRedis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin"
+	"github.com/tx7do/kratos-casbin/authz/casbin/pubsub"
+)
+
+func TestBroker(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := goRedis.NewClient(&goRedis.Options{Addr: server.Addr()})
+	defer client.Close()
+	broker := NewBroker(client)
+
+	a, err := pubsub.NewWatcher(context.Background(), broker, pubsub.WithInstanceID("a"))
+	assert.Nil(t, err)
+	defer a.Close()
+	b, err := pubsub.NewWatcher(context.Background(), broker, pubsub.WithInstanceID("b"))
+	assert.Nil(t, err)
+	defer b.Close()
+
+	received := make(chan casbin.WatcherMessage, 2)
+	for _, w := range []*pubsub.Watcher{a, b} {
+		_ = w.SetUpdateCallback(func(msg string) {
+			var m casbin.WatcherMessage
+			assert.Nil(t, json.Unmarshal([]byte(msg), &m))
+			received <- m
+		})
+	}
+
+	assert.Nil(t, a.UpdateForAddPolicy("p", "p", "alice", "/api", "GET"))
+	select {
+	case m := <-received:
+		assert.Equal(t, casbin.WatcherMessage{
+			Method:  casbin.WatcherUpdateForAddPolicy,
+			ID:      "a",
+			Sec:     "p",
+			Ptype:   "p",
+			NewRule: []string{"alice", "/api", "GET"},
+		}, m)
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+	// the publisher skipped its own message
+	select {
+	case m := <-received:
+		t.Fatalf("unexpected message %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,190 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+
+	"github.com/go-kratos/kratos/v2/log"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin"
+)
+
+const defaultChannel = "casbin"
+
+var (
+	_ persist.WatcherEx        = (*Watcher)(nil)
+	_ persist.UpdatableWatcher = (*Watcher)(nil)
+)
+
+// Option is a watcher option.
+type Option func(*Watcher)
+
+// WithChannel publish the updates on the channel, "casbin" by default
+func WithChannel(channel string) Option {
+	return func(w *Watcher) {
+		w.channel = channel
+	}
+}
+
+// WithInstanceID identify this instance in the messages, a random id by default
+func WithInstanceID(id string) Option {
+	return func(w *Watcher) {
+		w.id = id
+	}
+}
+
+// WithIgnoreSelf do not call the callback for the messages of this instance,
+// true by default
+func WithIgnoreSelf(ignore bool) Option {
+	return func(w *Watcher) {
+		w.ignoreSelf = ignore
+	}
+}
+
+// Watcher is a persist.WatcherEx sharing policy updates between the instances
+// of a cluster through a broker. Updates are sent as casbin.WatcherMessage,
+// which the middleware applies incrementally.
+type Watcher struct {
+	broker     Broker
+	channel    string
+	id         string
+	ignoreSelf bool
+
+	mu          sync.RWMutex
+	callback    func(string)
+	unsubscribe func() error
+	closeOnce   sync.Once
+}
+
+// NewWatcher subscribes to the updates of the other instances.
+func NewWatcher(ctx context.Context, broker Broker, opts ...Option) (*Watcher, error) {
+	w := &Watcher{
+		broker:     broker,
+		channel:    defaultChannel,
+		id:         newInstanceID(),
+		ignoreSelf: true,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	unsubscribe, err := broker.Subscribe(ctx, w.channel, w.receive)
+	if err != nil {
+		return nil, err
+	}
+	w.unsubscribe = unsubscribe
+	return w, nil
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ID returns the instance id.
+func (w *Watcher) ID() string {
+	return w.id
+}
+
+func (w *Watcher) receive(data []byte) {
+	var msg casbin.WatcherMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Warnf("casbin: pubsub watcher: invalid message: %v", err)
+		return
+	}
+	if w.ignoreSelf && msg.ID == w.id {
+		return
+	}
+
+	w.mu.RLock()
+	callback := w.callback
+	w.mu.RUnlock()
+	if callback != nil {
+		callback(string(data))
+	}
+}
+
+func (w *Watcher) publish(msg casbin.WatcherMessage) error {
+	msg.ID = w.id
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return w.broker.Publish(context.Background(), w.channel, data)
+}
+
+// SetUpdateCallback sets the callback called with the messages of the other instances.
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update asks the other instances to reload their policy.
+func (w *Watcher) Update() error {
+	return w.publish(casbin.WatcherMessage{Method: casbin.WatcherUpdate})
+}
+
+// UpdateForAddPolicy publishes an added rule.
+func (w *Watcher) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return w.publish(casbin.WatcherMessage{Method: casbin.WatcherUpdateForAddPolicy, Sec: sec, Ptype: ptype, NewRule: params})
+}
+
+// UpdateForRemovePolicy publishes a removed rule.
+func (w *Watcher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return w.publish(casbin.WatcherMessage{Method: casbin.WatcherUpdateForRemovePolicy, Sec: sec, Ptype: ptype, NewRule: params})
+}
+
+// UpdateForRemoveFilteredPolicy publishes a filtered removal.
+func (w *Watcher) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return w.publish(casbin.WatcherMessage{
+		Method: casbin.WatcherUpdateForRemoveFilteredPolicy, Sec: sec, Ptype: ptype,
+		FieldIndex: fieldIndex, FieldValues: fieldValues,
+	})
+}
+
+// UpdateForSavePolicy asks the other instances to reload their policy.
+func (w *Watcher) UpdateForSavePolicy(_ model.Model) error {
+	return w.publish(casbin.WatcherMessage{Method: casbin.WatcherUpdateForSavePolicy})
+}
+
+// UpdateForAddPolicies publishes added rules.
+func (w *Watcher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return w.publish(casbin.WatcherMessage{Method: casbin.WatcherUpdateForAddPolicies, Sec: sec, Ptype: ptype, NewRules: rules})
+}
+
+// UpdateForRemovePolicies publishes removed rules.
+func (w *Watcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return w.publish(casbin.WatcherMessage{Method: casbin.WatcherUpdateForRemovePolicies, Sec: sec, Ptype: ptype, NewRules: rules})
+}
+
+// UpdateForUpdatePolicy publishes an updated rule.
+func (w *Watcher) UpdateForUpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return w.publish(casbin.WatcherMessage{
+		Method: casbin.WatcherUpdateForUpdatePolicy, Sec: sec, Ptype: ptype, OldRule: oldRule, NewRule: newRule,
+	})
+}
+
+// UpdateForUpdatePolicies publishes updated rules.
+func (w *Watcher) UpdateForUpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	return w.publish(casbin.WatcherMessage{
+		Method: casbin.WatcherUpdateForUpdatePolicies, Sec: sec, Ptype: ptype, OldRules: oldRules, NewRules: newRules,
+	})
+}
+
+// Close unsubscribes from the broker.
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		if err := w.unsubscribe(); err != nil {
+			log.Warnf("casbin: pubsub watcher: unsubscribe: %v", err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin"
+)
+
+const testPolicy = `p, admin, /api/*, *
+g, bob, admin`
+
+// newInstance starts an instance of the cluster, serving with its own enforcer.
+func newInstance(t *testing.T, broker Broker, id string) (*casbinV2.SyncedEnforcer, *Watcher) {
+	w, err := NewWatcher(context.Background(), broker, WithInstanceID(id))
+	assert.Nil(t, err)
+	t.Cleanup(w.Close)
+
+	enforcer, err := casbin.NewEnforcer(casbin.WithCasbinPolicy(stringAdapter.NewAdapter(testPolicy)))
+	assert.Nil(t, err)
+	// the string adapter cannot save, the instances share the policy through the watcher
+	enforcer.EnableAutoSave(false)
+	_ = casbin.Server(casbin.WithEnforcer(enforcer), casbin.WithWatcher(w))
+	return enforcer, w
+}
+
+// TestWatcher runs the watcher tests against the broker.
+func TestWatcher(t *testing.T) {
+	RunBrokerTests(t, NewMemoryBroker())
+}
+
+// RunBrokerTests checks that policy changes made on one instance reach the
+// others through the broker.
+func RunBrokerTests(t *testing.T, broker Broker) {
+	a, _ := newInstance(t, broker, "a")
+	b, _ := newInstance(t, broker, "b")
+
+	eventually := func(e *casbinV2.SyncedEnforcer, sub, obj string, want bool) {
+		assert.Eventually(t, func() bool {
+			allowed, _ := e.Enforce(sub, obj, "GET")
+			return allowed == want
+		}, 2*time.Second, 10*time.Millisecond)
+	}
+
+	_, err := a.AddGroupingPolicy("alice", "admin")
+	assert.Nil(t, err)
+	eventually(b, "alice", "/api/users", true)
+
+	_, err = a.AddPolicies([][]string{{"carol", "/reports/*", "GET"}, {"dave", "/reports/*", "GET"}})
+	assert.Nil(t, err)
+	eventually(b, "dave", "/reports/q1", true)
+
+	_, err = a.UpdatePolicy([]string{"carol", "/reports/*", "GET"}, []string{"carol", "/audit/*", "GET"})
+	assert.Nil(t, err)
+	eventually(b, "carol", "/audit/log", true)
+	eventually(b, "carol", "/reports/q1", false)
+
+	_, err = b.RemoveFilteredGroupingPolicy(1, "admin")
+	assert.Nil(t, err)
+	eventually(a, "bob", "/api/users", false)
+	eventually(a, "alice", "/api/users", false)
+}
+
+func TestWatcherIgnoresSelf(t *testing.T) {
+	broker := NewMemoryBroker()
+	w, err := NewWatcher(context.Background(), broker, WithInstanceID("a"))
+	assert.Nil(t, err)
+	defer w.Close()
+	other, err := NewWatcher(context.Background(), broker, WithInstanceID("b"), WithChannel("other"))
+	assert.Nil(t, err)
+	defer other.Close()
+
+	var received []casbin.WatcherMessage
+	_ = w.SetUpdateCallback(func(msg string) {
+		var m casbin.WatcherMessage
+		assert.Nil(t, json.Unmarshal([]byte(msg), &m))
+		received = append(received, m)
+	})
+
+	assert.Nil(t, w.UpdateForAddPolicy("p", "p", "alice", "/api", "GET"))
+	assert.Nil(t, other.Update())
+	assert.Empty(t, received)
+
+	assert.Nil(t, broker.Publish(context.Background(), defaultChannel, []byte(`{"Method":"Update","ID":"b"}`)))
+	assert.Nil(t, broker.Publish(context.Background(), defaultChannel, []byte(`not json`)))
+	assert.Equal(t, []casbin.WatcherMessage{{Method: casbin.WatcherUpdate, ID: "b"}}, received)
+
+	w.Close()
+	assert.Nil(t, broker.Publish(context.Background(), defaultChannel, []byte(`{"Method":"Update","ID":"b"}`)))
+	assert.Len(t, received, 1)
+}
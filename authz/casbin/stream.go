@@ -0,0 +1,170 @@
+package casbin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/tx7do/kratos-casbin/authz"
+)
+
+// WithStreamReauthorization re-evaluate the authorization of streams while they
+// are open, on every message or at most once per interval when it is positive
+func WithStreamReauthorization(interval time.Duration) Option {
+	return func(o *options) {
+		o.streamReauthorization = true
+		o.streamReauthorizationInterval = interval
+	}
+}
+
+// StreamGuard re-evaluates the authorization of a long-lived stream, such as a
+// websocket or a gRPC stream, so revoked access terminates it.
+type StreamGuard struct {
+	o            *options
+	ctx          context.Context
+	securityUser authz.SecurityUser
+	interval     time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+	now     func() time.Time
+}
+
+// NewStreamGuard create a guard for the security user stored in ctx by Server,
+// HTTPFilter or the gRPC interceptors. The enforcer is passed with WithEnforcer
+// or WithTenantRegistry.
+func NewStreamGuard(ctx context.Context, opts ...Option) *StreamGuard {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.tenants != nil && o.tenantResolver == nil {
+		o.tenantResolver = tenantFromUser
+	}
+	securityUser, _ := SecurityUserFromContext(ctx)
+	return newStreamGuard(ctx, o, securityUser)
+}
+
+func newStreamGuard(ctx context.Context, o *options, securityUser authz.SecurityUser) *StreamGuard {
+	return &StreamGuard{
+		o:            o,
+		ctx:          ctx,
+		securityUser: securityUser,
+		interval:     o.streamReauthorizationInterval,
+		checked:      time.Now(),
+		now:          time.Now,
+	}
+}
+
+// Check re-evaluates the authorization, at most once per interval when one is
+// set. Once it fails every later call fails too. The decisions are reported to
+// the decision hook as rechecks.
+func (g *StreamGuard) Check() error {
+	return g.check(false)
+}
+
+func (g *StreamGuard) check(force bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.err != nil {
+		return g.err
+	}
+	now := g.now()
+	if !force && g.interval > 0 && now.Sub(g.checked) < g.interval {
+		return nil
+	}
+	g.checked = now
+
+	switch {
+	case g.o.currentEnforcer() == nil && g.o.tenants == nil:
+		g.err = ErrEnforcerMissing
+	case g.securityUser == nil:
+		g.err = ErrSecurityParseFailed
+	default:
+		decision := g.o.evaluate(g.ctx, g.securityUser)
+		decision.Recheck = true
+		g.err = g.o.decide(g.ctx, decision)
+	}
+	return g.err
+}
+
+// Err returns the error of the failed check, nil while access is granted.
+func (g *StreamGuard) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// Run checks the authorization every interval until ctx is done, calling
+// cancel once access is revoked. It returns at once when no interval is set.
+func (g *StreamGuard) Run(ctx context.Context, cancel context.CancelFunc) {
+	if g.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.check(true); err != nil {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// guardedStream re-authorizes every message sent or received on the stream.
+type guardedStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	guard *StreamGuard
+}
+
+func (s *guardedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *guardedStream) SendMsg(m interface{}) error {
+	if err := s.guard.Check(); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// RecvMsg returns as soon as access is revoked in interval mode, even when no
+// message arrives. The pending receive then completes in the background, the
+// stream is over and m must not be used.
+func (s *guardedStream) RecvMsg(m interface{}) error {
+	if s.guard.interval <= 0 {
+		if err := s.ServerStream.RecvMsg(m); err != nil {
+			return err
+		}
+		return s.guard.Check()
+	}
+
+	received := make(chan error, 1)
+	go func() {
+		received <- s.ServerStream.RecvMsg(m)
+	}()
+	select {
+	case err := <-received:
+		if err != nil {
+			return err
+		}
+		return s.guard.Check()
+	case <-s.ctx.Done():
+		if err := s.guard.Err(); err != nil {
+			return err
+		}
+		return status.FromContextError(s.ctx.Err()).Err()
+	}
+}
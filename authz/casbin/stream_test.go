@@ -0,0 +1,176 @@
+package casbin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthV1 "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+func TestStreamReauthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		notify   bool
+	}{
+		{
+			name:   "every message",
+			notify: true,
+		},
+		{
+			name:     "interval",
+			interval: 10 * time.Millisecond,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			enforcer, err := NewEnforcer(
+				WithCasbinPolicy(stringAdapter.NewAdapter("p, alice, /grpc.health.v1.Health/*, GET")),
+			)
+			assert.Nil(t, err)
+
+			client, hs := newBufconnClient(t,
+				grpc.StreamInterceptor(StreamServerInterceptor(
+					WithEnforcer(enforcer),
+					WithSecurityUserCreator(newHeaderSecurityUser),
+					WithStreamReauthorization(test.interval),
+				)),
+			)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-user", "alice")
+
+			stream, err := client.Watch(ctx, &healthV1.HealthCheckRequest{})
+			assert.Nil(t, err)
+			_, err = stream.Recv()
+			assert.Nil(t, err)
+
+			_, err = enforcer.RemovePolicy("alice", "/grpc.health.v1.Health/*", "GET")
+			assert.Nil(t, err)
+			if test.notify {
+				hs.SetServingStatus("", healthV1.HealthCheckResponse_NOT_SERVING)
+			}
+
+			_, err = stream.Recv()
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		})
+	}
+}
+
+func TestStreamGuard(t *testing.T) {
+	enforcer, err := NewEnforcer(
+		WithCasbinPolicy(stringAdapter.NewAdapter("p, alice, /ws, GET")),
+	)
+	assert.Nil(t, err)
+
+	header := headerCarrier{}
+	header.Set("X-User", "alice")
+	ctx := transport.NewServerContext(context.Background(), &Transport{operation: "/ws", reqHeader: header})
+	su := newHeaderSecurityUser()
+	assert.Nil(t, su.ParseFromContext(ctx))
+	ctx = context.WithValue(ctx, SecurityUserContextKey, su)
+
+	now := time.Now()
+	guard := NewStreamGuard(ctx, WithEnforcer(enforcer), WithStreamReauthorization(time.Minute))
+	guard.now = func() time.Time { return now }
+	guard.checked = now
+	assert.Nil(t, guard.Check())
+
+	_, err = enforcer.RemovePolicy("alice", "/ws", "GET")
+	assert.Nil(t, err)
+	assert.Nil(t, guard.Check())
+	assert.Nil(t, guard.Err())
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, ErrUnauthorized, guard.Check())
+	assert.Equal(t, ErrUnauthorized, guard.Err())
+
+	_, err = enforcer.AddPolicy("alice", "/ws", "GET")
+	assert.Nil(t, err)
+	now = now.Add(time.Minute)
+	assert.Equal(t, ErrUnauthorized, guard.Check())
+
+	assert.Equal(t, ErrSecurityParseFailed, NewStreamGuard(context.Background(), WithEnforcer(enforcer)).Check())
+	assert.Equal(t, ErrEnforcerMissing, NewStreamGuard(ctx).Check())
+}
+
+// blockingStream is a server stream whose client never sends a message.
+type blockingStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *blockingStream) Context() context.Context { return s.ctx }
+
+func (s *blockingStream) RecvMsg(interface{}) error {
+	<-s.ctx.Done()
+	return s.ctx.Err()
+}
+
+func TestGuardedStreamRecvMsg(t *testing.T) {
+	enforcer, err := NewEnforcer(
+		WithCasbinPolicy(stringAdapter.NewAdapter("p, alice, /ws, GET")),
+	)
+	assert.Nil(t, err)
+
+	header := headerCarrier{}
+	header.Set("X-User", "alice")
+	ctx := transport.NewServerContext(context.Background(), &Transport{operation: "/ws", reqHeader: header})
+	su := newHeaderSecurityUser()
+	assert.Nil(t, su.ParseFromContext(ctx))
+	ctx = context.WithValue(ctx, SecurityUserContextKey, su)
+
+	var decisions []Decision
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	guard := NewStreamGuard(ctx,
+		WithEnforcer(enforcer),
+		WithStreamReauthorization(10*time.Millisecond),
+		WithDecisionHook(func(_ context.Context, decision Decision) {
+			decisions = append(decisions, decision)
+		}),
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		guard.Run(ctx, cancel)
+	}()
+
+	_, err = enforcer.RemovePolicy("alice", "/ws", "GET")
+	assert.Nil(t, err)
+
+	// the revocation wakes the blocked receive
+	streamCtx, closeStream := context.WithCancel(context.Background())
+	defer closeStream()
+	stream := &guardedStream{ServerStream: &blockingStream{ctx: streamCtx}, ctx: ctx, guard: guard}
+	received := make(chan error, 1)
+	go func() {
+		received <- stream.RecvMsg(nil)
+	}()
+	select {
+	case err = <-received:
+		assert.Equal(t, ErrUnauthorized, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("RecvMsg was not interrupted")
+	}
+
+	<-done
+	if assert.NotEmpty(t, decisions) {
+		last := decisions[len(decisions)-1]
+		assert.True(t, last.Recheck)
+		assert.False(t, last.Allowed)
+	}
+}
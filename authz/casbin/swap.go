@@ -0,0 +1,201 @@
+package casbin
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+var ErrEnforcerRetired = errors.New("casbin: enforcer replaced by a reload of the swap enforcer")
+
+// SwapEnforcer reloads the policy into a new enforcer built off to the side
+// and swapped in atomically, so requests are not blocked by reloads. Policy
+// changes made through Enforcer are kept in its adapter; they are not
+// notified to watchers.
+type SwapEnforcer struct {
+	o       options
+	current atomic.Pointer[casbinV2.SyncedEnforcer]
+
+	mu       sync.Mutex
+	autoLoad chan struct{}
+}
+
+// NewSwapEnforcer creates a validated enforcer from the model and policy
+// options, as NewEnforcer, to be shared with WithSwapEnforcer.
+func NewSwapEnforcer(opts ...Option) (*SwapEnforcer, error) {
+	e := &SwapEnforcer{}
+	for _, opt := range opts {
+		opt(&e.o)
+	}
+	if e.o.model == nil {
+		e.o.model, _ = loadRbacModel()
+	}
+
+	enforcer, err := e.build()
+	if err != nil {
+		return nil, err
+	}
+	e.current.Store(enforcer)
+	return e, nil
+}
+
+func (e *SwapEnforcer) build() (*casbinV2.SyncedEnforcer, error) {
+	o := e.o
+	o.model = policy.CopyModel(e.o.model)
+	return newEnforcer(&o)
+}
+
+// Enforcer returns the current enforcer, replaced on every reload. Resolve it
+// for every operation: from the start of the reload replacing it, the policy
+// changes made through it, e.g. by a policy.Tx, policy.Snapshots or
+// TemporalRoles holding it, fail with ErrEnforcerRetired.
+func (e *SwapEnforcer) Enforcer() *casbinV2.SyncedEnforcer {
+	return e.current.Load()
+}
+
+// Enforce decides a request with the current enforcer.
+func (e *SwapEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	return e.current.Load().Enforce(rvals...)
+}
+
+// LoadPolicy builds a new enforcer from the adapter and swaps it in. The
+// current enforcer is kept when the new one cannot be built. Its changes are
+// rejected with ErrEnforcerRetired while the new one is built, as they might
+// be missed by it.
+func (e *SwapEnforcer) LoadPolicy() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.replace(e.build)
+}
+
+// replace retires the current enforcer and swaps in the one built, restoring
+// the current enforcer when the build fails. The caller holds mu.
+func (e *SwapEnforcer) replace(build func() (*casbinV2.SyncedEnforcer, error)) error {
+	current := e.current.Load()
+	adapter := setAdapter(current, retiredAdapter{})
+
+	enforcer, err := build()
+	if err != nil {
+		setAdapter(current, adapter)
+		return err
+	}
+	e.current.Store(enforcer)
+	return nil
+}
+
+// setAdapter sets the adapter of the enforcer under its lock, returning the
+// previous one.
+func setAdapter(enforcer *casbinV2.SyncedEnforcer, adapter persist.Adapter) persist.Adapter {
+	lock := enforcer.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	previous := enforcer.GetAdapter()
+	enforcer.SetAdapter(adapter)
+	return previous
+}
+
+// setModel replaces the model, keeping the current one when the policy cannot
+// be loaded with the new model.
+func (e *SwapEnforcer) setModel(m model.Model) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.replace(func() (*casbinV2.SyncedEnforcer, error) {
+		o := e.o
+		o.model = policy.CopyModel(m)
+		enforcer, err := newEnforcer(&o)
+		if err == nil {
+			e.o.model = m
+		}
+		return enforcer, err
+	})
+}
+
+// StartAutoLoad reloads the policy every interval until StopAutoLoad or
+// Close. It does nothing when auto loading is running.
+func (e *SwapEnforcer) StartAutoLoad(interval time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.autoLoad != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	e.autoLoad = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_ = e.LoadPolicy()
+			}
+		}
+	}()
+}
+
+// StopAutoLoad stops reloading the policy every interval.
+func (e *SwapEnforcer) StopAutoLoad() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.autoLoad != nil {
+		close(e.autoLoad)
+		e.autoLoad = nil
+	}
+}
+
+// Close stops auto loading, call it on shutdown, e.g. in kratos.AfterStop.
+func (e *SwapEnforcer) Close() {
+	e.StopAutoLoad()
+}
+
+// retiredAdapter is the adapter of the replaced enforcers, rejecting changes
+// which the current enforcer would not see.
+type retiredAdapter struct{}
+
+func (retiredAdapter) LoadPolicy(model.Model) error { return ErrEnforcerRetired }
+
+func (retiredAdapter) SavePolicy(model.Model) error { return ErrEnforcerRetired }
+
+func (retiredAdapter) AddPolicy(string, string, []string) error { return ErrEnforcerRetired }
+
+func (retiredAdapter) RemovePolicy(string, string, []string) error { return ErrEnforcerRetired }
+
+func (retiredAdapter) RemoveFilteredPolicy(string, string, int, ...string) error {
+	return ErrEnforcerRetired
+}
+
+func (retiredAdapter) AddPolicies(string, string, [][]string) error { return ErrEnforcerRetired }
+
+func (retiredAdapter) RemovePolicies(string, string, [][]string) error { return ErrEnforcerRetired }
+
+func (retiredAdapter) UpdatePolicy(string, string, []string, []string) error {
+	return ErrEnforcerRetired
+}
+
+func (retiredAdapter) UpdatePolicies(string, string, [][]string, [][]string) error {
+	return ErrEnforcerRetired
+}
+
+func (retiredAdapter) UpdateFilteredPolicies(string, string, [][]string, int, ...string) ([][]string, error) {
+	return nil, ErrEnforcerRetired
+}
+
+// WithSwapEnforcer serve requests with a copy-on-write enforcer, watcher
+// notifications and auto loads reloading it without blocking requests
+func WithSwapEnforcer(enforcer *SwapEnforcer) Option {
+	return func(o *options) {
+		o.swap = enforcer
+	}
+}
@@ -0,0 +1,254 @@
+package casbin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"github.com/go-kratos/kratos/v2/middleware/auth/jwt"
+	"github.com/go-kratos/kratos/v2/transport"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+// failingAdapter fails to load the policy once err is set.
+type failingAdapter struct {
+	*stringAdapter.Adapter
+	err error
+}
+
+func (a *failingAdapter) LoadPolicy(m model.Model) error {
+	if a.err != nil {
+		return a.err
+	}
+	return a.Adapter.LoadPolicy(m)
+}
+
+func TestSwapEnforcer(t *testing.T) {
+	a := &failingAdapter{Adapter: stringAdapter.NewAdapter(`p, bobo, /api/*, *`)}
+	swap, err := NewSwapEnforcer(WithCasbinPolicy(a))
+	assert.Nil(t, err)
+
+	server := Server(
+		WithSwapEnforcer(swap),
+		WithSecurityUserCreator(NewSecurityUser),
+	)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+
+	ctx := transport.NewServerContext(context.Background(), &Transport{operation: "/api/users"})
+	ctx = jwt.NewContext(ctx, createToken("alice"))
+	_, err = server(ctx, "request")
+	assert.Equal(t, ErrUnauthorized, err)
+
+	previous := swap.Enforcer()
+	a.Line = "p, bobo, /api/*, *\np, alice, /api/*, *"
+	assert.Nil(t, swap.LoadPolicy())
+	assert.NotSame(t, previous, swap.Enforcer())
+	allowed, _ := previous.Enforce("alice", "/api/users", "*")
+	assert.False(t, allowed)
+
+	_, err = server(ctx, "request")
+	assert.Nil(t, err)
+
+	// a policy which cannot be loaded keeps the current enforcer
+	current := swap.Enforcer()
+	a.err = errors.New("database is down")
+	assert.NotNil(t, swap.LoadPolicy())
+	assert.Same(t, current, swap.Enforcer())
+	_, err = server(ctx, "request")
+	assert.Nil(t, err)
+
+	// the changes made through a replaced enforcer are rejected
+	_, err = previous.AddPolicy("carol", "/api/*", "*")
+	assert.Equal(t, ErrEnforcerRetired, err)
+	_, err = policy.Begin(previous).Add("p", "carol", "/api/*", "*").Commit()
+	assert.ErrorIs(t, err, ErrEnforcerRetired)
+	has, _ := previous.HasPolicy("carol", "/api/*", "*")
+	assert.False(t, has)
+}
+
+// blockingAdapter blocks the policy loads once loading is set, until release
+// is closed.
+type blockingAdapter struct {
+	*stringAdapter.Adapter
+	loading chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (a *blockingAdapter) LoadPolicy(m model.Model) error {
+	if a.loading != nil {
+		close(a.loading)
+		<-a.release
+	}
+	if a.err != nil {
+		return a.err
+	}
+	return a.Adapter.LoadPolicy(m)
+}
+
+func TestSwapEnforcerWriteDuringReload(t *testing.T) {
+	a := &blockingAdapter{Adapter: stringAdapter.NewAdapter(`p, bobo, /api/*, *`)}
+	swap, err := NewSwapEnforcer(WithCasbinPolicy(a))
+	assert.Nil(t, err)
+
+	reload := func(err error) <-chan error {
+		a.loading, a.release, a.err = make(chan struct{}), make(chan struct{}), err
+		done := make(chan error)
+		go func() { done <- swap.LoadPolicy() }()
+		<-a.loading
+		return done
+	}
+
+	// the new enforcer may have read the adapter already
+	current := swap.Enforcer()
+	done := reload(nil)
+	_, err = current.AddPolicy("carol", "/api/*", "*")
+	assert.Equal(t, ErrEnforcerRetired, err)
+	_, err = policy.Begin(current).Add("p", "carol", "/api/*", "*").Commit()
+	assert.ErrorIs(t, err, ErrEnforcerRetired)
+	close(a.release)
+	assert.Nil(t, <-done)
+	assert.NotSame(t, current, swap.Enforcer())
+
+	// the current enforcer accepts changes again when the reload fails
+	current = swap.Enforcer()
+	done = reload(errors.New("database is down"))
+	_, err = current.AddPolicy("carol", "/api/*", "*")
+	assert.Equal(t, ErrEnforcerRetired, err)
+	close(a.release)
+	assert.NotNil(t, <-done)
+	assert.Same(t, current, swap.Enforcer())
+	a.loading = nil
+	added, err := current.AddPolicy("carol", "/api/*", "*")
+	assert.Nil(t, err)
+	assert.True(t, added)
+}
+
+// autoLoadAdapter counts the policy loads of the auto load goroutine.
+type autoLoadAdapter struct {
+	*stringAdapter.Adapter
+	loads atomic.Int32
+}
+
+func (a *autoLoadAdapter) LoadPolicy(m model.Model) error {
+	a.loads.Add(1)
+	return a.Adapter.LoadPolicy(m)
+}
+
+func TestSwapEnforcerAutoLoad(t *testing.T) {
+	a := &autoLoadAdapter{Adapter: stringAdapter.NewAdapter(`p, bobo, /api/*, *`)}
+	swap, err := NewSwapEnforcer(WithCasbinPolicy(a))
+	assert.Nil(t, err)
+
+	// every server shares the auto load of the swap enforcer
+	for i := 0; i < 3; i++ {
+		Server(
+			WithSwapEnforcer(swap),
+			WithSecurityUserCreator(NewSecurityUser),
+			WithAutoLoadPolicy(true, 10*time.Millisecond),
+		)
+	}
+	time.Sleep(55 * time.Millisecond)
+	swap.Close()
+	loads := a.loads.Load()
+	assert.LessOrEqual(t, loads, int32(7))
+	assert.Greater(t, loads, int32(1))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, loads, a.loads.Load())
+}
+
+// benchmarkPolicy returns a policy cheap to enforce, with few permissions, but
+// slow to load, with many role assignments.
+func benchmarkPolicy(roles, members int) string {
+	var sb strings.Builder
+	for i := 0; i < roles; i++ {
+		fmt.Fprintf(&sb, "p, role%d, /api/resource%d/*, GET\n", i, i)
+	}
+	for i := 0; i < members; i++ {
+		fmt.Fprintf(&sb, "g, member%d, role%d\n", i, i%roles)
+	}
+	return sb.String()
+}
+
+// benchmarkEnforceDuringReloads measures Enforce while the policy is reloaded
+// every few milliseconds, reporting the 99th percentile and the maximum latency.
+func benchmarkEnforceDuringReloads(b *testing.B, enforce func(rvals ...interface{}) (bool, error), reload func() error) {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_ = reload()
+			}
+		}
+	}()
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+	)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var local []time.Duration
+		for i := 0; pb.Next(); i++ {
+			start := time.Now()
+			_, _ = enforce(fmt.Sprintf("member%d", i), fmt.Sprintf("/api/resource%d/x", i%20), "GET")
+			local = append(local, time.Since(start))
+		}
+		mu.Lock()
+		latencies = append(latencies, local...)
+		mu.Unlock()
+	})
+	b.StopTimer()
+	close(stop)
+	wg.Wait()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	if len(latencies) > 0 {
+		b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+		b.ReportMetric(float64(latencies[len(latencies)-1].Nanoseconds()), "max-ns")
+	}
+}
+
+func BenchmarkReload(b *testing.B) {
+	policy := benchmarkPolicy(20, 50000)
+
+	b.Run("SyncedEnforcer", func(b *testing.B) {
+		m, _ := loadRbacModel()
+		enforcer, err := casbinV2.NewSyncedEnforcer(m, stringAdapter.NewAdapter(policy))
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkEnforceDuringReloads(b, enforcer.Enforce, enforcer.LoadPolicy)
+	})
+
+	b.Run("SwapEnforcer", func(b *testing.B) {
+		enforcer, err := NewSwapEnforcer(WithCasbinPolicy(stringAdapter.NewAdapter(policy)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkEnforceDuringReloads(b, enforcer.Enforce, enforcer.LoadPolicy)
+	})
+}
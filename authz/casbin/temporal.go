@@ -0,0 +1,350 @@
+package casbin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/util"
+
+	"github.com/go-kratos/kratos/v2/log"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+const (
+	// temporalTimeLayout is the time format of the casbin timeMatch condition, in UTC.
+	temporalTimeLayout = "2006-01-02 15:04:05"
+	// temporalUnbounded is the parameter of an unbounded window side.
+	temporalUnbounded = "_"
+
+	defaultTemporalInterval = time.Minute
+)
+
+var (
+	ErrInvalidTemporalWindow = errors.New("casbin: temporal role window ends before it starts")
+	// ErrTemporalAutoLoad is returned for WithAutoLoadPolicy without
+	// WithSwapEnforcer, the casbin auto load drops the window conditions.
+	ErrTemporalAutoLoad = errors.New("casbin: auto load of temporal roles requires WithSwapEnforcer")
+)
+
+// WithTemporalRoles enforce the validity windows of the role definitions, "g"
+// by default, see TemporalRoles. The window conditions are registered when the
+// enforcer is created and whenever this package reloads its policy, before it
+// is unlocked; pass it to NewSwapEnforcer and the tenant registry too.
+func WithTemporalRoles(ptypes ...string) Option {
+	if len(ptypes) == 0 {
+		ptypes = []string{"g"}
+	}
+	return func(o *options) {
+		o.temporalRoles = append(o.temporalRoles, ptypes...)
+	}
+}
+
+// TemporalOption is a temporal roles option.
+type TemporalOption func(*TemporalRoles)
+
+// WithTemporalPType manage the role assignments of the policy type, "g" by default
+func WithTemporalPType(ptype string) TemporalOption {
+	return func(t *TemporalRoles) {
+		t.ptype = ptype
+	}
+}
+
+// WithTemporalPublisher publish the granted and expired role assignments
+func WithTemporalPublisher(publishers ...policy.Publisher) TemporalOption {
+	return func(t *TemporalRoles) {
+		t.publishers = append(t.publishers, publishers...)
+	}
+}
+
+// WithTemporalInterval check the validity windows at least every interval,
+// one minute by default
+func WithTemporalInterval(interval time.Duration) TemporalOption {
+	return func(t *TemporalRoles) {
+		t.interval = interval
+	}
+}
+
+// TemporalRoles manages role assignments valid for a time window, with the
+// conditional role manager of casbin. The role definition carries the window
+// as parameters, "g = _, _, (_, _)", or "g = _, _, _, (_, _)" with domains:
+//
+//	g, cathy, admin, _, _
+//	g, alice, oncall, 2024-05-01 08:00:00, 2024-05-01 16:00:00
+//
+// Times are in UTC, "_" leaving a side unbounded. Assignments are valid only
+// within their window, and removed from the policy once expired.
+type TemporalRoles struct {
+	enforcer   *casbinV2.SyncedEnforcer
+	ptype      string
+	publishers []policy.Publisher
+	interval   time.Duration
+	now        func() time.Time
+
+	domain    bool
+	startOnce sync.Once
+	closeOnce sync.Once
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewTemporalRoles manages the temporal roles of the enforcer, call Start to
+// expire them automatically.
+func NewTemporalRoles(enforcer *casbinV2.SyncedEnforcer, opts ...TemporalOption) (*TemporalRoles, error) {
+	t := &TemporalRoles{
+		enforcer: enforcer,
+		ptype:    "g",
+		interval: defaultTemporalInterval,
+		now:      time.Now,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	if err := validateTemporalRoles(enforcer.GetModel(), []string{t.ptype}); err != nil {
+		return nil, err
+	}
+	t.domain = len(enforcer.GetModel()["g"][t.ptype].Tokens) > 2
+
+	t.RegisterConditions()
+	return t, nil
+}
+
+// validateTemporalRoles checks that the role definitions have a window.
+func validateTemporalRoles(m model.Model, ptypes []string) error {
+	for _, ptype := range ptypes {
+		ast, ok := m["g"][ptype]
+		if !ok || windowParams(ast.Value) != 2 {
+			return fmt.Errorf("casbin: role definition %s must have a (start, end) window, e.g. %s = _, _, (_, _)", ptype, ptype)
+		}
+	}
+	return nil
+}
+
+// registerLinkConditions sets the window condition on every assignment of
+// the role definitions, the caller holds the enforcer lock.
+func registerLinkConditions(e *casbinV2.Enforcer, ptypes []string) {
+	for _, ptype := range ptypes {
+		ast, ok := e.GetModel()["g"][ptype]
+		if !ok {
+			continue
+		}
+		domain := len(ast.Tokens) > 2
+		for _, rule := range ast.Policy {
+			if len(rule) < len(ast.Tokens) {
+				continue
+			}
+			if domain {
+				e.AddNamedDomainLinkConditionFunc(ptype, rule[0], rule[1], rule[2], util.TimeMatchFunc)
+			} else {
+				e.AddNamedLinkConditionFunc(ptype, rule[0], rule[1], util.TimeMatchFunc)
+			}
+		}
+	}
+}
+
+// loadTemporalPolicy reloads the policy of the enforcer, registering the
+// window conditions before it is unlocked, also when the load fails as casbin
+// rebuilds the role links then.
+func loadTemporalPolicy(enforcer *casbinV2.SyncedEnforcer, ptypes []string) error {
+	lock := enforcer.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	err := enforcer.Enforcer.LoadPolicy()
+	registerLinkConditions(enforcer.Enforcer, ptypes)
+	return err
+}
+
+// GrantTemporary assigns the role to the user from now until the given time,
+// in the domain for models with domains.
+func (t *TemporalRoles) GrantTemporary(user, role string, until time.Time, domain ...string) error {
+	return t.Grant(user, role, t.now(), until, domain...)
+}
+
+// Grant assigns the role to the user for the window, with second precision;
+// a zero time leaves its side unbounded.
+func (t *TemporalRoles) Grant(user, role string, from, until time.Time, domain ...string) error {
+	if !from.IsZero() && !until.IsZero() && !until.After(from) {
+		return ErrInvalidTemporalWindow
+	}
+	if t.domain != (len(domain) == 1) {
+		return fmt.Errorf("casbin: role definition %s expects %d domain(s), got %d", t.ptype, boolToInt(t.domain), len(domain))
+	}
+
+	rule := append([]string{user, role}, domain...)
+	rule = append(rule, formatTemporalTime(from), formatTemporalTime(until))
+	if _, err := policy.Begin(t.enforcer, policy.WithPublisher(t.publishers...), t.TxOption()).Add(t.ptype, rule...).Commit(); err != nil {
+		return err
+	}
+
+	// the next expiry may be earlier
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// windowParams returns the number of parameters of a role definition, such
+// as 2 for "_, _, (_, _)". The parameter tokens of the model are not used as
+// casbin drops them when copying models.
+func windowParams(definition string) int {
+	i := strings.Index(definition, "(")
+	if i < 0 {
+		return 0
+	}
+	return strings.Count(definition[i:], "_")
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func formatTemporalTime(t time.Time) string {
+	if t.IsZero() {
+		return temporalUnbounded
+	}
+	return t.UTC().Format(temporalTimeLayout)
+}
+
+// TxOption registers the window conditions of the assignments added by a
+// transaction before the enforcer is unlocked, and on the enforcers validating
+// it; pass it to policy.Begin or policy.NewSnapshots when changing the
+// assignments.
+func (t *TemporalRoles) TxOption() policy.TxOption {
+	ptypes := []string{t.ptype}
+	return func(tx *policy.Tx) {
+		policy.WithCandidateSetup(func(candidate *casbinV2.Enforcer) error {
+			registerLinkConditions(candidate, ptypes)
+			return nil
+		})(tx)
+		policy.WithCommitHook(func(e *casbinV2.Enforcer) {
+			registerLinkConditions(e, ptypes)
+		})(tx)
+	}
+}
+
+// LoadPolicy reloads the policy of the enforcer with the window conditions.
+func (t *TemporalRoles) LoadPolicy() error {
+	return loadTemporalPolicy(t.enforcer, []string{t.ptype})
+}
+
+// RegisterConditions sets the window condition on every assignment. Casbin
+// drops the conditions when it rebuilds the role links, leaving the windowed
+// assignments valid until they are registered again: call it after calling
+// LoadPolicy or BuildRoleLinks of the enforcer directly, or use LoadPolicy and
+// WithTemporalRoles which register them before the enforcer is unlocked.
+func (t *TemporalRoles) RegisterConditions() {
+	lock := t.enforcer.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+	registerLinkConditions(t.enforcer.Enforcer, []string{t.ptype})
+}
+
+// expired returns the assignments expired at now and the next expiry time,
+// zero when none is pending.
+func (t *TemporalRoles) expired(now time.Time) ([][]string, time.Time) {
+	lock := t.enforcer.GetLock()
+	lock.RLock()
+	defer lock.RUnlock()
+
+	var (
+		expired [][]string
+		next    time.Time
+	)
+	for _, rule := range t.enforcer.GetModel()["g"][t.ptype].Policy {
+		if len(rule) == 0 || rule[len(rule)-1] == temporalUnbounded {
+			continue
+		}
+		end, err := time.Parse(temporalTimeLayout, rule[len(rule)-1])
+		if err != nil {
+			continue
+		}
+		if !now.Before(end) {
+			expired = append(expired, rule)
+		} else if next.IsZero() || end.Before(next) {
+			next = end
+		}
+	}
+	return expired, next
+}
+
+// Expire removes the expired assignments from the policy, publishing the changes.
+func (t *TemporalRoles) Expire() (policy.Changeset, error) {
+	expired, _ := t.expired(t.now())
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	tx := policy.Begin(t.enforcer, policy.WithPublisher(t.publishers...), policy.WithSource(policy.SourceExpiry), t.TxOption())
+	for _, rule := range expired {
+		tx.Remove(t.ptype, rule...)
+	}
+	return tx.Commit()
+}
+
+// Start expires the assignments in the background, as soon as their window
+// ends, until Close.
+func (t *TemporalRoles) Start() {
+	t.startOnce.Do(func() {
+		go t.run()
+	})
+}
+
+func (t *TemporalRoles) run() {
+	defer close(t.done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-t.wake:
+		case <-timer.C:
+		}
+
+		t.RegisterConditions()
+		if _, err := t.Expire(); err != nil {
+			log.Errorf("casbin: expire temporal roles: %v", err)
+		}
+
+		wait := t.interval
+		if _, next := t.expired(t.now()); !next.IsZero() {
+			if d := next.Sub(t.now()); d < wait {
+				wait = d
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// Close stops expiring the assignments.
+func (t *TemporalRoles) Close() {
+	t.closeOnce.Do(func() {
+		close(t.stop)
+		t.startOnce.Do(func() {
+			close(t.done)
+		})
+		<-t.done
+	})
+}
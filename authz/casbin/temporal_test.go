@@ -0,0 +1,213 @@
+package casbin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+const temporalModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _, (_, _)
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch(r.obj, p.obj) && (r.act == p.act || p.act == "*")
+`
+
+func newTemporalEnforcer(t *testing.T) *casbinV2.SyncedEnforcer {
+	m, err := model.NewModelFromString(temporalModel)
+	assert.Nil(t, err)
+	enforcer, err := NewEnforcer(
+		WithCasbinModel(m),
+		WithCasbinPolicy(stringAdapter.NewAdapter(`p, oncall, /prod/*, *
+g, cathy, oncall, _, _`)),
+		WithTemporalRoles(),
+	)
+	assert.Nil(t, err)
+	// the string adapter cannot save
+	enforcer.EnableAutoSave(false)
+	return enforcer
+}
+
+func TestTemporalRoles(t *testing.T) {
+	enforcer := newTemporalEnforcer(t)
+	events := policy.NewChannelPublisher(8)
+	roles, err := NewTemporalRoles(enforcer, WithTemporalPublisher(events))
+	assert.Nil(t, err)
+	roles.Start()
+	defer roles.Close()
+
+	allowed := func(user string) bool {
+		ok, _ := enforcer.Enforce(user, "/prod/deploy", "POST")
+		return ok
+	}
+	assert.True(t, allowed("cathy"))
+
+	// a window in the future is not valid yet
+	now := time.Now()
+	assert.Nil(t, roles.Grant("bob", "oncall", now.Add(time.Hour), now.Add(2*time.Hour)))
+	assert.False(t, allowed("bob"))
+
+	assert.Nil(t, roles.GrantTemporary("alice", "oncall", time.Now().Add(2*time.Second)))
+	assert.True(t, allowed("alice"))
+	granted := <-events.Events()
+	assert.Equal(t, policy.SourceCommit, granted.Source)
+	<-events.Events()
+
+	// expired by the background loop
+	select {
+	case event := <-events.Events():
+		assert.Equal(t, policy.SourceExpiry, event.Source)
+		_, removed := event.Changes.Counts()
+		assert.Equal(t, 1, removed)
+		assert.Equal(t, "alice", event.Changes[0].Removed[0][0])
+	case <-time.After(5 * time.Second):
+		t.Fatal("alice's assignment did not expire")
+	}
+	assert.False(t, allowed("alice"))
+	assert.True(t, allowed("cathy"))
+	has, _ := enforcer.HasNamedGroupingPolicy("g", "bob", "oncall", formatTemporalTime(now.Add(time.Hour)), formatTemporalTime(now.Add(2*time.Hour)))
+	assert.True(t, has)
+}
+
+func TestTemporalRolesReload(t *testing.T) {
+	newModel := func() model.Model {
+		m, err := model.NewModelFromString(temporalModel)
+		assert.Nil(t, err)
+		return m
+	}
+	// bob's window is in the future
+	const rules = `p, oncall, /prod/*, *
+g, cathy, oncall, _, _
+g, bob, oncall, 2099-01-01 00:00:00, 2099-12-31 00:00:00`
+	allowed := func(enforcer interface {
+		Enforce(...interface{}) (bool, error)
+	}, user string) bool {
+		ok, err := enforcer.Enforce(user, "/prod/deploy", "POST")
+		assert.Nil(t, err)
+		return ok
+	}
+
+	t.Run("new enforcer", func(t *testing.T) {
+		enforcer, err := NewEnforcer(WithCasbinModel(newModel()), WithCasbinPolicy(stringAdapter.NewAdapter(rules)), WithTemporalRoles())
+		assert.Nil(t, err)
+		assert.True(t, allowed(enforcer, "cathy"))
+		assert.False(t, allowed(enforcer, "bob"))
+
+		roles, err := NewTemporalRoles(enforcer)
+		assert.Nil(t, err)
+		defer roles.Close()
+		assert.Nil(t, roles.LoadPolicy())
+		assert.True(t, allowed(enforcer, "cathy"))
+		assert.False(t, allowed(enforcer, "bob"))
+	})
+
+	t.Run("shared enforcer", func(t *testing.T) {
+		enforcer, err := casbinV2.NewSyncedEnforcer(newModel(), stringAdapter.NewAdapter(rules))
+		assert.Nil(t, err)
+		o := &options{}
+		for _, opt := range []Option{WithEnforcer(enforcer), WithTemporalRoles()} {
+			opt(o)
+		}
+		assert.Nil(t, o.init())
+		assert.False(t, allowed(enforcer, "bob"))
+	})
+
+	t.Run("watcher", func(t *testing.T) {
+		a := stringAdapter.NewAdapter(`p, oncall, /prod/*, *`)
+		w := &updateWatcher{}
+		o := &options{}
+		for _, opt := range []Option{WithCasbinModel(newModel()), WithCasbinPolicy(a), WithWatcher(w), WithTemporalRoles()} {
+			opt(o)
+		}
+		assert.Nil(t, o.init())
+
+		w.callback(watcherMessage(t, WatcherMessage{
+			Method: WatcherUpdateForAddPolicy, Sec: "g", Ptype: "g",
+			NewRule: []string{"bob", "oncall", "2099-01-01 00:00:00", "2099-12-31 00:00:00"},
+		}))
+		has, _ := o.enforcer.HasGroupingPolicy("bob", "oncall", "2099-01-01 00:00:00", "2099-12-31 00:00:00")
+		assert.True(t, has)
+		assert.False(t, allowed(o.enforcer, "bob"))
+
+		a.Line = rules
+		assert.Nil(t, w.Update())
+		assert.True(t, allowed(o.enforcer, "cathy"))
+		assert.False(t, allowed(o.enforcer, "bob"))
+	})
+
+	t.Run("swap enforcer", func(t *testing.T) {
+		swap, err := NewSwapEnforcer(WithCasbinModel(newModel()), WithCasbinPolicy(stringAdapter.NewAdapter(rules)), WithTemporalRoles())
+		assert.Nil(t, err)
+		assert.False(t, allowed(swap, "bob"))
+		assert.Nil(t, swap.LoadPolicy())
+		assert.True(t, allowed(swap, "cathy"))
+		assert.False(t, allowed(swap, "bob"))
+	})
+
+	t.Run("auto load", func(t *testing.T) {
+		o := &options{}
+		for _, opt := range []Option{
+			WithCasbinModel(newModel()), WithCasbinPolicy(stringAdapter.NewAdapter(rules)),
+			WithTemporalRoles(), WithAutoLoadPolicy(true, time.Minute),
+		} {
+			opt(o)
+		}
+		assert.Equal(t, ErrTemporalAutoLoad, o.init())
+	})
+}
+
+func TestTemporalRolesCandidate(t *testing.T) {
+	enforcer := newTemporalEnforcer(t)
+	roles, err := NewTemporalRoles(enforcer)
+	assert.Nil(t, err)
+	defer roles.Close()
+
+	// bob must not be on call before his window
+	validator := policy.WithValidator(func(candidate *casbinV2.Enforcer) error {
+		if ok, _ := candidate.Enforce("bob", "/prod/deploy", "POST"); ok {
+			return errors.New("bob is on call")
+		}
+		return nil
+	})
+	_, err = policy.Begin(enforcer, validator, roles.TxOption()).
+		Add("g", "bob", "oncall", "2099-01-01 00:00:00", "2099-12-31 00:00:00").
+		Commit()
+	assert.Nil(t, err)
+}
+
+func TestTemporalRolesValidation(t *testing.T) {
+	enforcer, err := NewEnforcer(WithCasbinPolicy(stringAdapter.NewAdapter(`p, admin, /*, *`)))
+	assert.Nil(t, err)
+	_, err = NewTemporalRoles(enforcer)
+	assert.NotNil(t, err)
+
+	roles, err := NewTemporalRoles(newTemporalEnforcer(t))
+	assert.Nil(t, err)
+	defer roles.Close()
+	now := time.Now()
+	assert.Equal(t, ErrInvalidTemporalWindow, roles.Grant("alice", "oncall", now, now.Add(-time.Hour)))
+	assert.NotNil(t, roles.GrantTemporary("alice", "oncall", now.Add(time.Hour), "acme"))
+
+	// nothing to expire
+	changes, err := roles.Expire()
+	assert.Nil(t, err)
+	assert.True(t, changes.Empty())
+}
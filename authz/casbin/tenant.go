@@ -0,0 +1,226 @@
+package casbin
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+
+	"github.com/tx7do/kratos-casbin/authz"
+)
+
+const defaultTenantCapacity = 128
+
+// TenantResolver resolves the tenant id of a request.
+type TenantResolver func(ctx context.Context, user authz.SecurityUser) (string, error)
+
+// TenantLoader loads the model and policy of a tenant.
+type TenantLoader interface {
+	LoadTenant(ctx context.Context, tenant string) (model.Model, persist.Adapter, error)
+}
+
+// TenantLoaderFunc is an adapter to allow the use of ordinary functions as TenantLoader.
+type TenantLoaderFunc func(ctx context.Context, tenant string) (model.Model, persist.Adapter, error)
+
+// LoadTenant calls f(ctx, tenant).
+func (f TenantLoaderFunc) LoadTenant(ctx context.Context, tenant string) (model.Model, persist.Adapter, error) {
+	return f(ctx, tenant)
+}
+
+type TenantOption func(*TenantRegistry)
+
+// WithTenantCapacity set the maximum number of tenants kept in memory
+func WithTenantCapacity(capacity int) TenantOption {
+	return func(r *TenantRegistry) {
+		r.capacity = capacity
+	}
+}
+
+// WithTenantIdleTimeout evict tenants which have not been used for the given duration
+func WithTenantIdleTimeout(timeout time.Duration) TenantOption {
+	return func(r *TenantRegistry) {
+		r.idleTimeout = timeout
+	}
+}
+
+type tenantEntry struct {
+	tenant   string
+	enforcer *casbinV2.SyncedEnforcer
+	err      error
+	ready    chan struct{}
+	lastUsed time.Time
+	element  *list.Element
+}
+
+// TenantRegistry keeps one enforcer per tenant, loading them lazily from a
+// TenantLoader and evicting the least recently used ones.
+type TenantRegistry struct {
+	loader      TenantLoader
+	capacity    int
+	idleTimeout time.Duration
+	options     options
+
+	mu      sync.Mutex
+	entries map[string]*tenantEntry
+	lru     *list.List
+	now     func() time.Time
+}
+
+// NewTenantRegistry create a tenant registry backed by the given loader.
+func NewTenantRegistry(loader TenantLoader, opts ...TenantOption) *TenantRegistry {
+	r := &TenantRegistry{
+		loader:   loader,
+		capacity: defaultTenantCapacity,
+		entries:  make(map[string]*tenantEntry),
+		lru:      list.New(),
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Enforcer returns the enforcer of the tenant, loading it on first use.
+func (r *TenantRegistry) Enforcer(ctx context.Context, tenant string) (*casbinV2.SyncedEnforcer, error) {
+	r.mu.Lock()
+	r.evictIdle()
+	entry, ok := r.entries[tenant]
+	if ok {
+		entry.lastUsed = r.now()
+		r.lru.MoveToFront(entry.element)
+		r.mu.Unlock()
+
+		<-entry.ready
+		return entry.enforcer, entry.err
+	}
+
+	entry = &tenantEntry{tenant: tenant, ready: make(chan struct{}), lastUsed: r.now()}
+	entry.element = r.lru.PushFront(entry)
+	r.entries[tenant] = entry
+	r.evictOverflow()
+	r.mu.Unlock()
+
+	entry.enforcer, entry.err = r.load(ctx, tenant)
+	close(entry.ready)
+
+	if entry.err != nil {
+		r.mu.Lock()
+		r.remove(entry)
+		r.mu.Unlock()
+	}
+	return entry.enforcer, entry.err
+}
+
+// Reload reloads the model and policy of a loaded tenant. The previous
+// enforcer keeps serving requests if the reload fails.
+func (r *TenantRegistry) Reload(ctx context.Context, tenant string) error {
+	r.mu.Lock()
+	entry, ok := r.entries[tenant]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	<-entry.ready
+
+	enforcer, err := r.load(ctx, tenant)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if current, ok := r.entries[tenant]; ok && current == entry {
+		ready := make(chan struct{})
+		close(ready)
+		replaced := &tenantEntry{tenant: tenant, enforcer: enforcer, ready: ready, lastUsed: entry.lastUsed}
+		replaced.element = r.lru.InsertBefore(replaced, entry.element)
+		r.remove(entry)
+		r.entries[tenant] = replaced
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// Evict drops the tenant from memory, it is loaded again on next use.
+func (r *TenantRegistry) Evict(tenant string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.entries[tenant]; ok {
+		r.remove(entry)
+	}
+}
+
+// Tenants returns the loaded tenants, most recently used first.
+func (r *TenantRegistry) Tenants() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenants := make([]string, 0, r.lru.Len())
+	for e := r.lru.Front(); e != nil; e = e.Next() {
+		tenants = append(tenants, e.Value.(*tenantEntry).tenant)
+	}
+	return tenants
+}
+
+func (r *TenantRegistry) load(ctx context.Context, tenant string) (*casbinV2.SyncedEnforcer, error) {
+	if r.loader == nil {
+		return nil, fmt.Errorf("casbin: tenant loader is missing")
+	}
+	m, a, err := r.loader.LoadTenant(ctx, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("casbin: load tenant %q: %w", tenant, err)
+	}
+	if m == nil {
+		m, _ = loadRbacModel()
+	}
+	o := r.options
+	o.model, o.policy = m, a
+	enforcer, err := newEnforcer(&o)
+	if err != nil {
+		return nil, fmt.Errorf("casbin: tenant %q: %w", tenant, err)
+	}
+	return enforcer, nil
+}
+
+func (r *TenantRegistry) evictIdle() {
+	if r.idleTimeout <= 0 {
+		return
+	}
+	deadline := r.now().Add(-r.idleTimeout)
+	for e := r.lru.Back(); e != nil; {
+		entry := e.Value.(*tenantEntry)
+		e = e.Prev()
+		if entry.lastUsed.After(deadline) {
+			break
+		}
+		r.remove(entry)
+	}
+}
+
+func (r *TenantRegistry) evictOverflow() {
+	if r.capacity <= 0 {
+		return
+	}
+	for r.lru.Len() > r.capacity {
+		r.remove(r.lru.Back().Value.(*tenantEntry))
+	}
+}
+
+func (r *TenantRegistry) remove(entry *tenantEntry) {
+	if current, ok := r.entries[entry.tenant]; ok && current == entry {
+		delete(r.entries, entry.tenant)
+	}
+	if entry.element != nil {
+		r.lru.Remove(entry.element)
+		entry.element = nil
+	}
+}
+
+// tenantFromUser is the default TenantResolver, using the domain of the security user.
+func tenantFromUser(_ context.Context, user authz.SecurityUser) (string, error) {
+	return user.GetDomain(), nil
+}
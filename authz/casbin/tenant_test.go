@@ -0,0 +1,201 @@
+package casbin
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	kratosErrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware/auth/jwt"
+	"github.com/go-kratos/kratos/v2/transport"
+
+	jwtV5 "github.com/golang-jwt/jwt/v5"
+)
+
+const aclModelConfig = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act
+`
+
+type tenantPolicies map[string]string
+
+func (tp tenantPolicies) loader(loads *int32) TenantLoaderFunc {
+	return func(_ context.Context, tenant string) (model.Model, persist.Adapter, error) {
+		atomic.AddInt32(loads, 1)
+		policy, ok := tp[tenant]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown tenant")
+		}
+		if tenant == "globex" {
+			m, _ := model.NewModelFromString(aclModelConfig)
+			return m, stringAdapter.NewAdapter(policy), nil
+		}
+		m, _ := model.NewModelFromString(modelConfig)
+		return m, stringAdapter.NewAdapter(policy), nil
+	}
+}
+
+func TestTenantRegistry(t *testing.T) {
+	policies := tenantPolicies{
+		"acme":    "p, admin, /api/*, *",
+		"globex":  "p, admin, /api/users, GET",
+		"initech": "p, admin, /api/*, *\ng, bob, admin",
+	}
+
+	t.Run("lazy loading", func(t *testing.T) {
+		var loads int32
+		r := NewTenantRegistry(policies.loader(&loads))
+		assert.Empty(t, r.Tenants())
+
+		e1, err := r.Enforcer(context.Background(), "acme")
+		assert.Nil(t, err)
+		e2, err := r.Enforcer(context.Background(), "acme")
+		assert.Nil(t, err)
+		assert.Same(t, e1, e2)
+		assert.Equal(t, int32(1), loads)
+
+		allowed, _ := e1.Enforce("admin", "/api/users", "POST")
+		assert.True(t, allowed)
+
+		e3, err := r.Enforcer(context.Background(), "globex")
+		assert.Nil(t, err)
+		allowed, _ = e3.Enforce("admin", "/api/users", "POST")
+		assert.False(t, allowed)
+
+		_, err = r.Enforcer(context.Background(), "unknown")
+		assert.Error(t, err)
+		assert.Equal(t, []string{"globex", "acme"}, r.Tenants())
+	})
+
+	t.Run("lru eviction", func(t *testing.T) {
+		var loads int32
+		r := NewTenantRegistry(policies.loader(&loads), WithTenantCapacity(2))
+
+		_, _ = r.Enforcer(context.Background(), "acme")
+		_, _ = r.Enforcer(context.Background(), "globex")
+		_, _ = r.Enforcer(context.Background(), "acme")
+		_, _ = r.Enforcer(context.Background(), "initech")
+		assert.Equal(t, []string{"initech", "acme"}, r.Tenants())
+
+		_, _ = r.Enforcer(context.Background(), "globex")
+		assert.Equal(t, int32(4), loads)
+	})
+
+	t.Run("idle eviction", func(t *testing.T) {
+		var loads int32
+		now := time.Now()
+		r := NewTenantRegistry(policies.loader(&loads), WithTenantIdleTimeout(time.Minute))
+		r.now = func() time.Time { return now }
+
+		_, _ = r.Enforcer(context.Background(), "acme")
+		now = now.Add(30 * time.Second)
+		_, _ = r.Enforcer(context.Background(), "globex")
+		now = now.Add(45 * time.Second)
+		_, _ = r.Enforcer(context.Background(), "globex")
+		assert.Equal(t, []string{"globex"}, r.Tenants())
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		var loads int32
+		tp := tenantPolicies{"acme": "p, admin, /api/users, GET"}
+		r := NewTenantRegistry(tp.loader(&loads))
+
+		e, _ := r.Enforcer(context.Background(), "acme")
+		allowed, _ := e.Enforce("admin", "/api/users", "POST")
+		assert.False(t, allowed)
+
+		tp["acme"] = "p, admin, /api/users, POST"
+		assert.Nil(t, r.Reload(context.Background(), "acme"))
+		e, _ = r.Enforcer(context.Background(), "acme")
+		allowed, _ = e.Enforce("admin", "/api/users", "POST")
+		assert.True(t, allowed)
+
+		delete(tp, "acme")
+		assert.Error(t, r.Reload(context.Background(), "acme"))
+		e2, err := r.Enforcer(context.Background(), "acme")
+		assert.Nil(t, err)
+		assert.Same(t, e, e2)
+
+		r.Evict("acme")
+		assert.Empty(t, r.Tenants())
+		assert.Nil(t, r.Reload(context.Background(), "acme"))
+	})
+}
+
+func TestServerWithTenantRegistry(t *testing.T) {
+	var loads int32
+	registry := NewTenantRegistry(tenantPolicies{
+		"acme":   "p, admin, /api/*, *",
+		"globex": "p, admin, /api/users, GET",
+	}.loader(&loads))
+
+	tests := []struct {
+		name      string
+		domain    string
+		path      string
+		exceptErr error
+	}{
+		{
+			name:      "acme allowed",
+			domain:    "acme",
+			path:      "/api/login",
+			exceptErr: nil,
+		},
+		{
+			name:      "globex denied",
+			domain:    "globex",
+			path:      "/api/login",
+			exceptErr: ErrUnauthorized,
+		},
+		{
+			name:      "missing tenant",
+			domain:    "",
+			path:      "/api/login",
+			exceptErr: ErrTenantMissing,
+		},
+		{
+			name:      "unknown tenant",
+			domain:    "unknown",
+			path:      "/api/login",
+			exceptErr: ErrEnforcerMissing,
+		},
+	}
+
+	server := Server(
+		WithTenantRegistry(registry),
+		WithSecurityUserCreator(NewSecurityUser),
+	)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := transport.NewServerContext(context.Background(), &Transport{operation: test.path})
+			ctx = jwt.NewContext(ctx, jwtV5.MapClaims{ClaimAuthorityId: "admin", Domain: test.domain})
+
+			_, err := server(ctx, "request")
+			if test.exceptErr == nil {
+				assert.Nil(t, err)
+				return
+			}
+			assert.Equal(t, kratosErrors.FromError(test.exceptErr).Message, kratosErrors.FromError(err).Message)
+		})
+	}
+}
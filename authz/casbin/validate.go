@@ -0,0 +1,83 @@
+package casbin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+var roleFuncPattern = regexp.MustCompile(`\b(g\d*)\s*\(`)
+
+// Validate checks that the configured model and policy can serve the requests
+// the middleware will make, so misconfiguration is reported at startup
+// instead of as an opaque casbin error on every request.
+func Validate(opts ...Option) error {
+	_, err := NewEnforcer(opts...)
+	return err
+}
+
+// validateModel checks the request definition arity against the arguments
+// passed to Enforce and that every role function used by the matcher is defined.
+func validateModel(m model.Model, enableDomain bool) error {
+	r, ok := m["r"]["r"]
+	if !ok {
+		return fmt.Errorf("casbin: model has no request definition, add a [request_definition] section with r = sub, obj, act")
+	}
+
+	want, expected := 3, "r = sub, obj, act"
+	if enableDomain {
+		want, expected = 4, "r = sub, dom, obj, act"
+	}
+	if len(r.Tokens) != want {
+		hint := "remove WithDomainSupport() or change the request definition"
+		if !enableDomain {
+			hint = "enable WithDomainSupport() or change the request definition"
+		}
+		return fmt.Errorf("casbin: request definition %q has %d fields but the middleware passes %d (%s), %s",
+			r.Value, len(r.Tokens), want, expected, hint)
+	}
+
+	if _, ok = m["p"]["p"]; !ok {
+		return fmt.Errorf("casbin: model has no policy definition, add a [policy_definition] section")
+	}
+
+	matcher, ok := m["m"]["m"]
+	if !ok {
+		return fmt.Errorf("casbin: model has no matcher, add a [matchers] section")
+	}
+
+	for _, match := range roleFuncPattern.FindAllStringSubmatch(matcher.Value, -1) {
+		if _, ok = m["g"][match[1]]; !ok {
+			return fmt.Errorf("casbin: matcher uses %s() but the model has no role definition %q, add it to [role_definition]",
+				match[1], match[1])
+		}
+	}
+
+	return nil
+}
+
+// validatePolicy checks every loaded rule against the arity of its definition.
+func validatePolicy(m model.Model) error {
+	for ptype, ast := range m["p"] {
+		for _, rule := range ast.Policy {
+			if len(rule) != len(ast.Tokens) {
+				return fmt.Errorf("casbin: policy rule %q has %d fields but %s = %s expects %d",
+					ptype+", "+strings.Join(rule, ", "), len(rule), ptype, ast.Value, len(ast.Tokens))
+			}
+		}
+	}
+
+	for ptype, ast := range m["g"] {
+		count := strings.Count(ast.Value, "_")
+		for _, rule := range ast.Policy {
+			if len(rule) < count {
+				return fmt.Errorf("casbin: role rule %q has %d fields but %s = %s expects %d",
+					ptype+", "+strings.Join(rule, ", "), len(rule), ptype, ast.Value, count)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package casbin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+
+	"github.com/go-kratos/kratos/v2/log"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+// Methods of watcher messages, named after the persist.WatcherEx and
+// persist.UpdatableWatcher functions sending them.
+const (
+	WatcherUpdate                        = "Update"
+	WatcherUpdateForAddPolicy            = "UpdateForAddPolicy"
+	WatcherUpdateForRemovePolicy         = "UpdateForRemovePolicy"
+	WatcherUpdateForRemoveFilteredPolicy = "UpdateForRemoveFilteredPolicy"
+	WatcherUpdateForSavePolicy           = "UpdateForSavePolicy"
+	WatcherUpdateForAddPolicies          = "UpdateForAddPolicies"
+	WatcherUpdateForRemovePolicies       = "UpdateForRemovePolicies"
+	WatcherUpdateForUpdatePolicy         = "UpdateForUpdatePolicy"
+	WatcherUpdateForUpdatePolicies       = "UpdateForUpdatePolicies"
+)
+
+var errFullReload = errors.New("casbin: watcher message requires a full reload")
+
+// WatcherMessage is a policy change notification, in the JSON format of the
+// casbin redis watcher.
+type WatcherMessage struct {
+	Method      string     `json:"Method"`
+	ID          string     `json:"ID"`
+	Sec         string     `json:"Sec,omitempty"`
+	Ptype       string     `json:"Ptype,omitempty"`
+	OldRule     []string   `json:"OldRule,omitempty"`
+	OldRules    [][]string `json:"OldRules,omitempty"`
+	NewRule     []string   `json:"NewRule,omitempty"`
+	NewRules    [][]string `json:"NewRules,omitempty"`
+	FieldIndex  int        `json:"FieldIndex,omitempty"`
+	FieldValues []string   `json:"FieldValues,omitempty"`
+}
+
+// modelWatcher is a watcher providing the model to reload, such as FileWatcher.
+type modelWatcher interface {
+	Model() model.Model
+}
+
+// onWatcherUpdate applies the watcher message to the in-memory model, falling
+// back to a full reload when the message cannot be interpreted
+func (o *options) onWatcherUpdate(msg string) {
+	if mw, ok := o.watcher.(modelWatcher); ok && watcherMethod(msg) == WatcherUpdateForModel {
+		o.reloadModel(mw.Model())
+		return
+	}
+
+	changes, err := o.applyWatcherMessage(o.currentEnforcer(), msg)
+	if err != nil {
+		if !errors.Is(err, errFullReload) {
+			log.Warnf("casbin: apply watcher message, reloading policy: %v", err)
+		}
+		o.reloadPolicy()
+		return
+	}
+	o.publish(changes)
+}
+
+func watcherMethod(msg string) string {
+	var m WatcherMessage
+	_ = json.Unmarshal([]byte(msg), &m)
+	return m.Method
+}
+
+// reloadModel replaces the model of the enforcer and reloads its policy, keeping
+// the current ones when the model does not fit the options
+func (o *options) reloadModel(m model.Model) {
+	if err := validateModel(m, o.enableDomain); err != nil {
+		log.Errorf("casbin: reload model, keeping the current one: %v", err)
+		return
+	}
+
+	before := rulesOf(o.currentEnforcer())
+	var err error
+	if o.swap != nil {
+		err = o.swap.setModel(m)
+	} else {
+		err = o.replaceModel(m)
+	}
+	if err != nil {
+		log.Errorf("casbin: reload model: %v", err)
+		return
+	}
+	o.publish(policy.Diff(before, rulesOf(o.currentEnforcer())))
+}
+
+// replaceModel replaces the model of the shared enforcer under its lock,
+// restoring the previous model when the policy cannot be loaded. The settings
+// of the enforcer, such as auto-save, are kept, and the functions of the
+// options registered again; casbin drops the other functions, the effector and
+// the role managers set on the enforcer.
+func (o *options) replaceModel(m model.Model) error {
+	enforcer := o.enforcer
+	enforcer.GetLock().Lock()
+	defer enforcer.GetLock().Unlock()
+
+	e := enforcer.Enforcer
+	previous := e.GetModel()
+	flags := flagsOf(e)
+	// SetModel resets the settings, the role links are built by LoadPolicy
+	e.SetModel(m)
+	err := o.setupFunctions(e)
+	if err == nil {
+		err = e.LoadPolicy()
+	}
+	if err == nil {
+		err = validatePolicy(e.GetModel())
+	}
+	if err == nil {
+		err = validateTemporalRoles(e.GetModel(), o.temporalRoles)
+	}
+	if err != nil {
+		e.SetModel(previous)
+		_ = o.setupFunctions(e)
+		_ = e.BuildRoleLinks()
+	}
+	registerLinkConditions(e, o.temporalRoles)
+	flags.restore(e)
+
+	// SetModel drops the watcher
+	_ = e.SetWatcher(o.watcher)
+	_ = o.watcher.SetUpdateCallback(o.onWatcherUpdate)
+	return err
+}
+
+// enforcerFlags are the settings reset by Enforcer.SetModel.
+type enforcerFlags struct {
+	enabled, autoSave, autoBuildRoleLinks, autoNotifyWatcher, autoNotifyDispatcher bool
+}
+
+// flagsOf reads the settings of the enforcer, which casbin only has setters
+// for; the casbin defaults are assumed for the fields it does not have.
+func flagsOf(e *casbinV2.Enforcer) enforcerFlags {
+	v := reflect.ValueOf(e).Elem()
+	flag := func(name string) bool {
+		f := v.FieldByName(name)
+		return f.Kind() != reflect.Bool || f.Bool()
+	}
+	return enforcerFlags{
+		enabled:              flag("enabled"),
+		autoSave:             flag("autoSave"),
+		autoBuildRoleLinks:   flag("autoBuildRoleLinks"),
+		autoNotifyWatcher:    flag("autoNotifyWatcher"),
+		autoNotifyDispatcher: flag("autoNotifyDispatcher"),
+	}
+}
+
+func (f enforcerFlags) restore(e *casbinV2.Enforcer) {
+	e.EnableEnforce(f.enabled)
+	e.EnableAutoSave(f.autoSave)
+	e.EnableAutoBuildRoleLinks(f.autoBuildRoleLinks)
+	e.EnableAutoNotifyWatcher(f.autoNotifyWatcher)
+	e.EnableAutoNotifyDispatcher(f.autoNotifyDispatcher)
+}
+
+// applyWatcherMessage applies an incremental watcher message to the enforcer
+// without writing to its adapter, returning the applied changes.
+func (o *options) applyWatcherMessage(enforcer *casbinV2.SyncedEnforcer, msg string) (policy.Changeset, error) {
+	var m WatcherMessage
+	if err := json.Unmarshal([]byte(msg), &m); err != nil {
+		return nil, errFullReload
+	}
+
+	switch m.Method {
+	case WatcherUpdateForAddPolicy, WatcherUpdateForRemovePolicy, WatcherUpdateForUpdatePolicy:
+		if m.Method != WatcherUpdateForUpdatePolicy {
+			// single rules are sent as NewRule
+			m.NewRules = [][]string{m.NewRule}
+		} else {
+			m.OldRules, m.NewRules = [][]string{m.OldRule}, [][]string{m.NewRule}
+		}
+	case WatcherUpdateForAddPolicies, WatcherUpdateForRemovePolicies, WatcherUpdateForUpdatePolicies,
+		WatcherUpdateForRemoveFilteredPolicy:
+	default:
+		return nil, errFullReload
+	}
+	if m.Sec != "p" && m.Sec != "g" {
+		return nil, fmt.Errorf("invalid section %q", m.Sec)
+	}
+
+	enforcer.GetLock().Lock()
+	defer enforcer.GetLock().Unlock()
+
+	e := enforcer.Enforcer
+	if _, err := e.GetModel().GetAssertion(m.Sec, m.Ptype); err != nil {
+		return nil, err
+	}
+
+	change := policy.Change{Section: m.Sec, PType: m.Ptype}
+	var err error
+	switch m.Method {
+	case WatcherUpdateForAddPolicy, WatcherUpdateForAddPolicies:
+		change.Added, err = e.GetModel().AddPoliciesWithAffected(m.Sec, m.Ptype, m.NewRules)
+	case WatcherUpdateForRemovePolicy, WatcherUpdateForRemovePolicies:
+		change.Removed, err = e.GetModel().RemovePoliciesWithAffected(m.Sec, m.Ptype, m.NewRules)
+	case WatcherUpdateForRemoveFilteredPolicy:
+		_, change.Removed, err = e.GetModel().RemoveFilteredPolicy(m.Sec, m.Ptype, m.FieldIndex, m.FieldValues...)
+	case WatcherUpdateForUpdatePolicy, WatcherUpdateForUpdatePolicies:
+		if len(m.OldRules) != len(m.NewRules) {
+			return nil, fmt.Errorf("%s: %d old rules for %d new rules", m.Method, len(m.OldRules), len(m.NewRules))
+		}
+		var updated bool
+		if updated, err = e.GetModel().UpdatePolicies(m.Sec, m.Ptype, m.OldRules, m.NewRules); updated {
+			change.Removed, change.Added = m.OldRules, m.NewRules
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Sec == "g" {
+		err = buildIncrementalRoleLinks(e, m.Ptype, change)
+		registerLinkConditions(e, o.temporalPTypes())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return nil, nil
+	}
+	return policy.Changeset{change}, nil
+}
+
+func buildIncrementalRoleLinks(e *casbinV2.Enforcer, ptype string, change policy.Change) error {
+	if len(change.Removed) > 0 {
+		if err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, change.Removed); err != nil {
+			return err
+		}
+		if err := e.BuildIncrementalConditionalRoleLinks(model.PolicyRemove, ptype, change.Removed); err != nil {
+			return err
+		}
+	}
+	if len(change.Added) > 0 {
+		if err := e.BuildIncrementalRoleLinks(model.PolicyAdd, ptype, change.Added); err != nil {
+			return err
+		}
+		if err := e.BuildIncrementalConditionalRoleLinks(model.PolicyAdd, ptype, change.Added); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package casbin
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/casbin/casbin/v2/model"
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+// countingAdapter counts the full policy loads.
+type countingAdapter struct {
+	*stringAdapter.Adapter
+	loads int
+}
+
+func (a *countingAdapter) LoadPolicy(m model.Model) error {
+	a.loads++
+	return a.Adapter.LoadPolicy(m)
+}
+
+func watcherMessage(t *testing.T, m WatcherMessage) string {
+	data, err := json.Marshal(m)
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestWatcherIncrementalUpdates(t *testing.T) {
+	a := &countingAdapter{Adapter: stringAdapter.NewAdapter("p, admin, /api/*, *\np, bob, /api/users, GET")}
+	w := &updateWatcher{}
+	publisher := policy.NewChannelPublisher(16)
+
+	o := &options{}
+	for _, opt := range []Option{WithCasbinPolicy(a), WithWatcher(w), WithPublisher(publisher)} {
+		opt(o)
+	}
+	assert.Nil(t, o.init())
+	assert.Equal(t, 1, a.loads)
+
+	enforce := func(sub, obj, act string) bool {
+		allowed, err := o.enforcer.Enforce(sub, obj, act)
+		assert.Nil(t, err)
+		return allowed
+	}
+
+	w.callback(watcherMessage(t, WatcherMessage{
+		Method: WatcherUpdateForAddPolicy, Sec: "g", Ptype: "g", NewRule: []string{"alice", "admin"},
+	}))
+	assert.True(t, enforce("alice", "/api/orders", "DELETE"))
+	event := <-publisher.Events()
+	assert.Equal(t, policy.Changeset{{Section: "g", PType: "g", Added: [][]string{{"alice", "admin"}}}}, event.Changes)
+
+	w.callback(watcherMessage(t, WatcherMessage{
+		Method: WatcherUpdateForUpdatePolicy, Sec: "p", Ptype: "p",
+		OldRule: []string{"bob", "/api/users", "GET"}, NewRule: []string{"bob", "/api/users", "POST"},
+	}))
+	assert.False(t, enforce("bob", "/api/users", "GET"))
+	assert.True(t, enforce("bob", "/api/users", "POST"))
+	event = <-publisher.Events()
+	assert.Equal(t, policy.Changeset{{Section: "p", PType: "p",
+		Added:   [][]string{{"bob", "/api/users", "POST"}},
+		Removed: [][]string{{"bob", "/api/users", "GET"}},
+	}}, event.Changes)
+
+	w.callback(watcherMessage(t, WatcherMessage{
+		Method: WatcherUpdateForRemoveFilteredPolicy, Sec: "g", Ptype: "g", FieldIndex: 1, FieldValues: []string{"admin"},
+	}))
+	assert.False(t, enforce("alice", "/api/orders", "DELETE"))
+	event = <-publisher.Events()
+	assert.Equal(t, policy.Changeset{{Section: "g", PType: "g", Removed: [][]string{{"alice", "admin"}}}}, event.Changes)
+
+	w.callback(watcherMessage(t, WatcherMessage{
+		Method: WatcherUpdateForRemovePolicies, Sec: "p", Ptype: "p", NewRules: [][]string{{"admin", "/api/*", "*"}},
+	}))
+	assert.False(t, enforce("admin", "/api/orders", "GET"))
+	<-publisher.Events()
+	assert.Equal(t, 1, a.loads)
+
+	// messages which cannot be applied incrementally reload the whole policy
+	for _, msg := range []string{
+		"",
+		"not json",
+		watcherMessage(t, WatcherMessage{Method: WatcherUpdate}),
+		watcherMessage(t, WatcherMessage{Method: WatcherUpdateForSavePolicy}),
+		watcherMessage(t, WatcherMessage{Method: WatcherUpdateForAddPolicy, Sec: "p", Ptype: "p9", NewRule: []string{"x"}}),
+	} {
+		w.callback(msg)
+	}
+	assert.Equal(t, 6, a.loads)
+	assert.True(t, enforce("admin", "/api/orders", "GET"))
+	assert.True(t, enforce("bob", "/api/users", "GET"))
+}
+
+// modelUpdateWatcher is an updateWatcher providing the model to reload,
+// counting the updates of the enforcer.
+type modelUpdateWatcher struct {
+	updateWatcher
+	model   model.Model
+	updates int
+}
+
+func (w *modelUpdateWatcher) Update() error {
+	w.updates++
+	return nil
+}
+
+func (w *modelUpdateWatcher) Model() model.Model {
+	return w.model
+}
+
+// savingAdapter records the rules saved incrementally.
+type savingAdapter struct {
+	*stringAdapter.Adapter
+	added [][]string
+}
+
+func (a *savingAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	a.added = append(a.added, rule)
+	return nil
+}
+
+func TestWatcherModelReloadKeepsSettings(t *testing.T) {
+	const modelConfig = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act && !banned(r.sub)
+`
+	a := &savingAdapter{Adapter: stringAdapter.NewAdapter("p, alice, /api/users, GET\np, mallory, /api/users, GET")}
+	w := &modelUpdateWatcher{}
+	o := &options{}
+	for _, opt := range []Option{
+		WithCasbinPolicy(a),
+		WithWatcher(w),
+		WithFunction("banned", func(args ...interface{}) (interface{}, error) {
+			return args[0] == "mallory", nil
+		}),
+	} {
+		opt(o)
+	}
+	m, err := model.NewModelFromString(modelConfig)
+	assert.Nil(t, err)
+	o.model = m
+	assert.Nil(t, o.init())
+	o.enforcer.EnableAutoSave(false)
+	o.enforcer.EnableAutoNotifyWatcher(false)
+
+	w.model, err = model.NewModelFromString(strings.Replace(modelConfig, "r.obj == p.obj", "keyMatch(r.obj, p.obj)", 1))
+	assert.Nil(t, err)
+	w.callback(watcherMessage(t, WatcherMessage{Method: WatcherUpdateForModel}))
+
+	allowed, err := o.enforcer.Enforce("alice", "/api/users", "GET")
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+	allowed, err = o.enforcer.Enforce("mallory", "/api/users", "GET")
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+
+	added, err := o.enforcer.AddPolicy("bob", "/api/*", "GET")
+	assert.Nil(t, err)
+	assert.True(t, added)
+	assert.Empty(t, a.added)
+	assert.Zero(t, w.updates)
+}
@@ -0,0 +1,231 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/go-kratos/kratos/v2/transport"
+
+	"github.com/tx7do/kratos-casbin/authz"
+)
+
+const spiffeScheme = "spiffe"
+
+const (
+	ActionRead  = "read"
+	ActionWrite = "write"
+)
+
+// readMethodPrefixes are the method name prefixes of read-only operations.
+var readMethodPrefixes = []string{"Get", "List", "Watch", "Search", "Find", "Describe", "Check", "Count", "Query"}
+
+var (
+	ErrPeerCertificateMissing = errors.New("verified peer certificate missing")
+	ErrIdentityMissing        = errors.New("peer certificate has no identity")
+	ErrOperationMissing       = errors.New("transport operation missing")
+)
+
+// IdentityFunc extracts the identity of a verified peer certificate.
+type IdentityFunc func(cert *x509.Certificate) string
+
+// ActionFunc resolves the casbin action of an operation.
+type ActionFunc func(ctx context.Context, operation string) string
+
+type Option func(*options)
+
+type options struct {
+	identity      IdentityFunc
+	subjectMapper func(identity string) string
+	action        ActionFunc
+	domain        string
+}
+
+// WithIdentity set the function extracting the identity from the peer certificate
+func WithIdentity(identity IdentityFunc) Option {
+	return func(o *options) {
+		o.identity = identity
+	}
+}
+
+// WithSubjectMapper map the peer identity to a casbin subject
+func WithSubjectMapper(mapper func(identity string) string) Option {
+	return func(o *options) {
+		o.subjectMapper = mapper
+	}
+}
+
+// WithActionResolver set the function resolving the action of an operation, e.g. MethodAction,
+// "*" is used by default
+func WithActionResolver(action ActionFunc) Option {
+	return func(o *options) {
+		o.action = action
+	}
+}
+
+// WithDomain set the domain reported by GetDomain
+func WithDomain(domain string) Option {
+	return func(o *options) {
+		o.domain = domain
+	}
+}
+
+// SecurityUser is an authz.SecurityUser identified by the client certificate of the connection.
+type SecurityUser struct {
+	Identity    string
+	Subject     string
+	Operation   string
+	Action      string
+	Domain      string
+	Certificate *x509.Certificate
+
+	options *options
+}
+
+// NewSecurityUserCreator create a SecurityUserCreator for mutual TLS peers.
+// With MethodAction, the policy
+//
+//	p, spiffe://cluster/ns/billing/sa/api, /orders.v1.*, read
+//
+// lets the billing service call /orders.v1.OrderService/GetOrder but not
+// /orders.v1.OrderService/DeleteOrder:
+//
+//	casbin.Server(
+//		casbin.WithCasbinPolicy(adapter),
+//		casbin.WithSecurityUserCreator(mtls.NewSecurityUserCreator(mtls.WithActionResolver(mtls.MethodAction))),
+//	)
+func NewSecurityUserCreator(opts ...Option) authz.SecurityUserCreator {
+	o := &options{
+		identity: DefaultIdentity,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func() authz.SecurityUser {
+		return &SecurityUser{options: o}
+	}
+}
+
+func (su *SecurityUser) ParseFromContext(ctx context.Context) error {
+	if su.options == nil {
+		su.options = &options{identity: DefaultIdentity}
+	}
+
+	cert := PeerCertificateFromContext(ctx)
+	if cert == nil {
+		return ErrPeerCertificateMissing
+	}
+
+	su.Certificate = cert
+	su.Identity = su.options.identity(cert)
+	if su.Identity == "" {
+		return ErrIdentityMissing
+	}
+
+	su.Subject = su.Identity
+	if su.options.subjectMapper != nil {
+		su.Subject = su.options.subjectMapper(su.Identity)
+	}
+
+	tr, ok := transport.FromServerContext(ctx)
+	if !ok {
+		return ErrOperationMissing
+	}
+	su.Operation = tr.Operation()
+
+	su.Action = "*"
+	if su.options.action != nil {
+		su.Action = su.options.action(ctx, su.Operation)
+	}
+	su.Domain = su.options.domain
+
+	return nil
+}
+
+func (su *SecurityUser) GetSubject() string {
+	return su.Subject
+}
+
+func (su *SecurityUser) GetObject() string {
+	return su.Operation
+}
+
+func (su *SecurityUser) GetAction() string {
+	return su.Action
+}
+
+func (su *SecurityUser) GetDomain() string {
+	return su.Domain
+}
+
+// MethodAction resolves ActionRead for the operations whose method name starts
+// with a read-only verb, such as Get, List or Watch, and ActionWrite otherwise.
+// The verb must be a whole word: CheckoutCart is a write.
+func MethodAction(_ context.Context, operation string) string {
+	method := operation[strings.LastIndex(operation, "/")+1:]
+	for _, prefix := range readMethodPrefixes {
+		if rest, ok := strings.CutPrefix(method, prefix); ok && (rest == "" || unicode.IsUpper(rune(rest[0]))) {
+			return ActionRead
+		}
+	}
+	return ActionWrite
+}
+
+// DefaultIdentity returns the SPIFFE ID of the certificate, falling back to
+// its first DNS SAN and then to its common name.
+func DefaultIdentity(cert *x509.Certificate) string {
+	if id := SPIFFEID(cert); id != "" {
+		return id
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
+
+// SPIFFEID returns the spiffe:// URI SAN of the certificate.
+func SPIFFEID(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == spiffeScheme {
+			return uri.String()
+		}
+	}
+	return ""
+}
+
+// CommonName returns the common name of the certificate subject.
+func CommonName(cert *x509.Certificate) string {
+	return cert.Subject.CommonName
+}
+
+// PeerCertificateFromContext returns the verified leaf certificate of the
+// gRPC peer or the HTTP client, nil if the connection is not mutual TLS.
+func PeerCertificateFromContext(ctx context.Context) *x509.Certificate {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			return verifiedLeaf(&info.State)
+		}
+	}
+
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		if ht, ok := tr.(interface{ Request() *http.Request }); ok && ht.Request() != nil {
+			return verifiedLeaf(ht.Request().TLS)
+		}
+	}
+
+	return nil
+}
+
+func verifiedLeaf(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
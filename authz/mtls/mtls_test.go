@@ -0,0 +1,160 @@
+package mtls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	stringAdapter "github.com/casbin/casbin/v2/persist/string-adapter"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/go-kratos/kratos/v2/transport"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin"
+)
+
+type Transport struct {
+	kind      transport.Kind
+	operation string
+	request   *http.Request
+}
+
+func (tr *Transport) Kind() transport.Kind            { return tr.kind }
+func (tr *Transport) Endpoint() string                { return "" }
+func (tr *Transport) Operation() string               { return tr.operation }
+func (tr *Transport) RequestHeader() transport.Header { return nil }
+func (tr *Transport) ReplyHeader() transport.Header   { return nil }
+func (tr *Transport) Request() *http.Request          { return tr.request }
+
+func createCertificate(t *testing.T, cn string, dnsNames []string, uris ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for _, uri := range uris {
+		u, _ := url.Parse(uri)
+		template.URIs = append(template.URIs, u)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert
+}
+
+func grpcContext(cert *x509.Certificate, operation string) context.Context {
+	state := tls.ConnectionState{}
+	if cert != nil {
+		state.PeerCertificates = []*x509.Certificate{cert}
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	return transport.NewServerContext(ctx, &Transport{kind: transport.KindGRPC, operation: operation})
+}
+
+func TestDefaultIdentity(t *testing.T) {
+	spiffe := createCertificate(t, "api", []string{"api.billing.svc"}, "https://example.com", "spiffe://cluster/ns/billing/sa/api")
+	assert.Equal(t, "spiffe://cluster/ns/billing/sa/api", DefaultIdentity(spiffe))
+	assert.Equal(t, "api", CommonName(spiffe))
+
+	dns := createCertificate(t, "api", []string{"api.billing.svc"})
+	assert.Equal(t, "api.billing.svc", DefaultIdentity(dns))
+
+	cn := createCertificate(t, "api", nil)
+	assert.Equal(t, "api", DefaultIdentity(cn))
+}
+
+func TestParseFromContext(t *testing.T) {
+	cert := createCertificate(t, "api", nil, "spiffe://cluster/ns/billing/sa/api")
+
+	t.Run("grpc peer", func(t *testing.T) {
+		su := NewSecurityUserCreator(WithDomain("billing"))()
+		assert.Nil(t, su.ParseFromContext(grpcContext(cert, "/orders.v1.OrderService/GetOrder")))
+		assert.Equal(t, "spiffe://cluster/ns/billing/sa/api", su.GetSubject())
+		assert.Equal(t, "/orders.v1.OrderService/GetOrder", su.GetObject())
+		assert.Equal(t, "*", su.GetAction())
+		assert.Equal(t, "billing", su.GetDomain())
+	})
+
+	t.Run("http client certificate", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "https://localhost/orders", nil)
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		ctx := transport.NewServerContext(context.Background(), &Transport{kind: transport.KindHTTP, operation: "/orders.v1.OrderService/GetOrder", request: r})
+
+		su := NewSecurityUserCreator(WithSubjectMapper(func(identity string) string {
+			return strings.TrimPrefix(identity, "spiffe://cluster/")
+		}))()
+		assert.Nil(t, su.ParseFromContext(ctx))
+		assert.Equal(t, "ns/billing/sa/api", su.GetSubject())
+	})
+
+	t.Run("unverified certificate", func(t *testing.T) {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+		}}})
+		ctx = transport.NewServerContext(ctx, &Transport{kind: transport.KindGRPC, operation: "/orders.v1.OrderService/GetOrder"})
+
+		su := NewSecurityUserCreator()()
+		assert.Equal(t, ErrPeerCertificateMissing, su.ParseFromContext(ctx))
+	})
+
+	t.Run("no tls", func(t *testing.T) {
+		su := NewSecurityUserCreator()()
+		assert.Equal(t, ErrPeerCertificateMissing, su.ParseFromContext(grpcContext(nil, "/orders.v1.OrderService/GetOrder")))
+	})
+}
+
+func TestMethodAction(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, ActionRead, MethodAction(ctx, "/orders.v1.OrderService/GetOrder"))
+	assert.Equal(t, ActionRead, MethodAction(ctx, "/orders.v1.OrderService/ListOrders"))
+	assert.Equal(t, ActionWrite, MethodAction(ctx, "/orders.v1.OrderService/DeleteOrder"))
+	assert.Equal(t, ActionWrite, MethodAction(ctx, "/orders.v1.OrderService/CreateOrder"))
+	assert.Equal(t, ActionWrite, MethodAction(ctx, "/cart.v1.CartService/CheckoutCart"))
+	assert.Equal(t, ActionRead, MethodAction(ctx, "GetOrder"))
+}
+
+func TestServer(t *testing.T) {
+	server := casbin.Server(
+		casbin.WithCasbinPolicy(stringAdapter.NewAdapter("p, spiffe://cluster/ns/billing/sa/api, /orders.v1.*, read")),
+		casbin.WithSecurityUserCreator(NewSecurityUserCreator(WithActionResolver(MethodAction))),
+	)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+
+	billing := createCertificate(t, "api", nil, "spiffe://cluster/ns/billing/sa/api")
+	shipping := createCertificate(t, "api", nil, "spiffe://cluster/ns/shipping/sa/api")
+
+	_, err := server(grpcContext(billing, "/orders.v1.OrderService/GetOrder"), "request")
+	assert.Nil(t, err)
+
+	_, err = server(grpcContext(billing, "/orders.v1.OrderService/ListOrders"), "request")
+	assert.Nil(t, err)
+
+	_, err = server(grpcContext(billing, "/orders.v1.OrderService/DeleteOrder"), "request")
+	assert.Error(t, err)
+
+	_, err = server(grpcContext(shipping, "/orders.v1.OrderService/GetOrder"), "request")
+	assert.Error(t, err)
+}
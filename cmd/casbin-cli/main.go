@@ -0,0 +1,317 @@
+// Command casbin-cli answers authorization questions about a casbin model and
+// policy, interactively or as a one-shot command.
+//
+//	casbin-cli -model authz_model.conf -policy authz_policy.csv [command args...]
+//	casbin-cli -model authz_model.conf -driver postgres -dsn "postgres://..." [-table casbin_rule] [command args...]
+//
+// The policy is read from a CSV file, or from a database table written by the
+// sqladapter package with -driver sqlite, mysql or postgres and its DSN.
+//
+// Commands:
+//
+//	enforce <sub> [dom] <obj> <act>   decide a request
+//	explain <sub> [dom] <obj> <act>   decide a request and show the matching rule and roles
+//	roles <user> [--domain <dom>]     list the roles of a user, inherited ones included
+//	users <role> [--domain <dom>]     list the users having a role, inherited ones included
+//	perms <user> [--domain <dom>]     list the permissions of a user, inherited ones included
+//	reload                            reload the policy
+//
+// Without a command it reads commands from standard input until EOF or "exit".
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/persist"
+	fileAdapter "github.com/casbin/casbin/v2/persist/file-adapter"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/adapter/sqladapter"
+)
+
+const usage = `commands:
+  enforce <sub> [dom] <obj> <act>
+  explain <sub> [dom] <obj> <act>
+  roles <user> [--domain <dom>]
+  users <role> [--domain <dom>]
+  perms <user> [--domain <dom>]
+  reload
+  help
+  exit`
+
+var errUsage = errors.New("invalid arguments, type help for usage")
+
+// drivers maps the -driver values to the database/sql driver and the dialect.
+var drivers = map[string]struct {
+	name    string
+	dialect sqladapter.Dialect
+}{
+	"sqlite":   {"sqlite", sqladapter.SQLite},
+	"mysql":    {"mysql", sqladapter.MySQL},
+	"postgres": {"pgx", sqladapter.Postgres},
+}
+
+func main() {
+	modelPath := flag.String("model", "", "path of the model CONF file")
+	var src source
+	flag.StringVar(&src.policy, "policy", "", "path of the policy CSV file")
+	flag.StringVar(&src.driver, "driver", "", "database of the policy instead of a file, sqlite, mysql or postgres")
+	flag.StringVar(&src.dsn, "dsn", "", "data source name of the policy database")
+	flag.StringVar(&src.table, "table", "", "policy table, casbin_rule by default")
+	flag.Parse()
+
+	if *modelPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	a, closer, err := src.adapter()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "casbin-cli: %v\n", err)
+		os.Exit(2)
+	}
+	defer closer.Close()
+
+	enforcer, err := casbinV2.NewEnforcer(*modelPath, a)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "casbin-cli: %v\n", err)
+		os.Exit(2)
+	}
+	c := &cli{enforcer: enforcer, out: os.Stdout}
+
+	if flag.NArg() > 0 {
+		if err = c.run(flag.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "casbin-cli: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	c.repl(os.Stdin)
+}
+
+// source is the location of the policy, a CSV file or a database.
+type source struct {
+	policy string
+	driver string
+	dsn    string
+	table  string
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// adapter returns the adapter of the source and the closer of its resources.
+func (s source) adapter() (persist.Adapter, io.Closer, error) {
+	switch {
+	case s.policy != "" && s.driver != "":
+		return nil, nil, errors.New("-policy and -driver are exclusive")
+	case s.policy != "":
+		return fileAdapter.NewAdapter(s.policy), nopCloser{}, nil
+	case s.driver == "":
+		return nil, nil, errors.New("-policy or -driver is required")
+	}
+
+	driver, ok := drivers[s.driver]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown driver %q", s.driver)
+	}
+	if s.dsn == "" {
+		return nil, nil, errors.New("-dsn is required with -driver")
+	}
+	db, err := sql.Open(driver.name, s.dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var opts []sqladapter.Option
+	if s.table != "" {
+		opts = append(opts, sqladapter.WithTableName(s.table))
+	}
+	a, err := sqladapter.NewAdapter(db, driver.dialect, opts...)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+	return a, db, nil
+}
+
+type cli struct {
+	enforcer *casbinV2.Enforcer
+	out      io.Writer
+}
+
+func (c *cli) repl(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(c.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(c.out)
+			return
+		}
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return
+		}
+		if err := c.run(args); err != nil {
+			fmt.Fprintf(c.out, "error: %v\n", err)
+		}
+	}
+}
+
+func (c *cli) run(args []string) error {
+	command, args := args[0], args[1:]
+	switch command {
+	case "enforce":
+		return c.enforce(args, false)
+	case "explain":
+		return c.enforce(args, true)
+	case "roles":
+		return c.roles(args)
+	case "users":
+		return c.users(args)
+	case "perms":
+		return c.perms(args)
+	case "reload":
+		return c.enforcer.LoadPolicy()
+	case "help":
+		fmt.Fprintln(c.out, usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q, type help for usage", command)
+	}
+}
+
+func (c *cli) enforce(args []string, explain bool) error {
+	tokens := c.enforcer.GetModel()["r"]["r"].Tokens
+	if len(args) != len(tokens) {
+		return fmt.Errorf("expected %d values for r = %s", len(tokens), c.enforcer.GetModel()["r"]["r"].Value)
+	}
+
+	request := make([]interface{}, len(args))
+	for i, arg := range args {
+		request[i] = arg
+	}
+	allowed, rule, err := c.enforcer.EnforceEx(request...)
+	if err != nil {
+		return err
+	}
+
+	if allowed {
+		fmt.Fprintln(c.out, "allow")
+	} else {
+		fmt.Fprintln(c.out, "deny")
+	}
+	if !explain {
+		return nil
+	}
+
+	if len(rule) > 0 {
+		fmt.Fprintf(c.out, "  matched: %s\n", strings.Join(rule, ", "))
+	} else {
+		fmt.Fprintln(c.out, "  matched: no rule")
+	}
+	var domain []string
+	if len(args) == 4 {
+		domain = args[1:2]
+	}
+	roles, err := c.enforcer.GetImplicitRolesForUser(args[0], domain...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "  roles: %s\n", list(roles))
+	return nil
+}
+
+func (c *cli) roles(args []string) error {
+	name, domain, err := parseNameDomain(args)
+	if err != nil {
+		return err
+	}
+	roles, err := c.enforcer.GetImplicitRolesForUser(name, domain...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, list(roles))
+	return nil
+}
+
+func (c *cli) users(args []string) error {
+	name, domain, err := parseNameDomain(args)
+	if err != nil {
+		return err
+	}
+	users, err := c.enforcer.GetImplicitUsersForRole(name, domain...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, list(users))
+	return nil
+}
+
+func (c *cli) perms(args []string) error {
+	name, domain, err := parseNameDomain(args)
+	if err != nil {
+		return err
+	}
+	perms, err := c.enforcer.GetImplicitPermissionsForUser(name, domain...)
+	if err != nil {
+		return err
+	}
+	if len(perms) == 0 {
+		fmt.Fprintln(c.out, "(none)")
+	}
+	for _, perm := range perms {
+		fmt.Fprintln(c.out, strings.Join(perm, ", "))
+	}
+	return nil
+}
+
+// parseNameDomain parses "<name> [--domain <dom>]".
+func parseNameDomain(args []string) (string, []string, error) {
+	var (
+		name   string
+		domain []string
+	)
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--domain" || args[i] == "-domain":
+			if i+1 >= len(args) {
+				return "", nil, errUsage
+			}
+			i++
+			domain = []string{args[i]}
+		case strings.HasPrefix(args[i], "--domain="):
+			domain = []string{strings.TrimPrefix(args[i], "--domain=")}
+		case name == "":
+			name = args[i]
+		default:
+			return "", nil, errUsage
+		}
+	}
+	if name == "" {
+		return "", nil, errUsage
+	}
+	return name, domain, nil
+}
+
+func list(values []string) string {
+	if len(values) == 0 {
+		return "(none)"
+	}
+	return strings.Join(values, ", ")
+}
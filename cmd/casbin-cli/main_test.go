@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/adapter/sqladapter"
+)
+
+const (
+	modelPath  = "../../examples/authz_model.conf"
+	policyPath = "../../examples/authz_policy.csv"
+)
+
+func TestParseNameDomain(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		user   string
+		domain []string
+		err    error
+	}{
+		{name: "name", args: []string{"alice"}, user: "alice"},
+		{name: "domain flag", args: []string{"alice", "--domain", "acme"}, user: "alice", domain: []string{"acme"}},
+		{name: "domain before name", args: []string{"-domain", "acme", "alice"}, user: "alice", domain: []string{"acme"}},
+		{name: "domain assignment", args: []string{"alice", "--domain=acme"}, user: "alice", domain: []string{"acme"}},
+		{name: "missing domain", args: []string{"alice", "--domain"}, err: errUsage},
+		{name: "missing name", args: []string{"--domain", "acme"}, err: errUsage},
+		{name: "extra argument", args: []string{"alice", "bob"}, err: errUsage},
+		{name: "empty", err: errUsage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, domain, err := parseNameDomain(test.args)
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.user, user)
+			assert.Equal(t, test.domain, domain)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	enforcer, err := casbinV2.NewEnforcer(modelPath, policyPath)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name string
+		args []string
+		out  string
+		err  string
+	}{
+		{name: "enforce allow", args: []string{"enforce", "alice", "/dataset1/x", "GET"}, out: "allow\n"},
+		{name: "enforce deny", args: []string{"enforce", "alice", "/dataset1/x", "DELETE"}, out: "deny\n"},
+		{name: "enforce arity", args: []string{"enforce", "alice", "/dataset1/x"}, err: "expected 3 values for r = sub, obj, act"},
+		{
+			name: "explain inherited",
+			args: []string{"explain", "cathy", "/dataset1/x", "DELETE"},
+			out:  "allow\n  matched: dataset1_admin, /dataset1/*, *\n  roles: dataset1_admin\n",
+		},
+		{
+			name: "explain deny",
+			args: []string{"explain", "bob", "/dataset1/x", "GET"},
+			out:  "deny\n  matched: no rule\n  roles: (none)\n",
+		},
+		{name: "roles", args: []string{"roles", "admin"}, out: "api_admin\n"},
+		{name: "users", args: []string{"users", "dataset1_admin"}, out: "cathy\n"},
+		{name: "perms", args: []string{"perms", "admin"}, out: "api_admin, /api/*, *\n"},
+		{name: "perms none", args: []string{"perms", "nobody"}, out: "(none)\n"},
+		{name: "roles usage", args: []string{"roles"}, err: errUsage.Error()},
+		{name: "unknown command", args: []string{"grant"}, err: `unknown command "grant", type help for usage`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			c := &cli{enforcer: enforcer, out: &out}
+			err := c.run(test.args)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.out, out.String())
+		})
+	}
+}
+
+func TestSourceAdapter(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "casbin.db")
+	db, err := sql.Open("sqlite", dsn)
+	assert.Nil(t, err)
+	defer db.Close()
+	a, err := sqladapter.NewAdapter(db, sqladapter.SQLite, sqladapter.WithTableName("rules"))
+	assert.Nil(t, err)
+	assert.Nil(t, a.Migrate(context.Background()))
+	assert.Nil(t, a.AddPolicies("g", "g", [][]string{{"cathy", "dataset1_admin"}}))
+	assert.Nil(t, a.AddPolicies("p", "p", [][]string{{"dataset1_admin", "/dataset1/*", "*"}}))
+
+	tests := []struct {
+		name string
+		src  source
+		err  string
+	}{
+		{name: "file", src: source{policy: policyPath}},
+		{name: "database", src: source{driver: "sqlite", dsn: dsn, table: "rules"}},
+		{name: "none", err: "-policy or -driver is required"},
+		{name: "both", src: source{policy: policyPath, driver: "sqlite"}, err: "-policy and -driver are exclusive"},
+		{name: "unknown driver", src: source{driver: "oracle", dsn: dsn}, err: `unknown driver "oracle"`},
+		{name: "missing dsn", src: source{driver: "sqlite"}, err: "-dsn is required with -driver"},
+		{name: "invalid table", src: source{driver: "sqlite", dsn: dsn, table: "rules; drop"}, err: sqladapter.ErrInvalidTableName.Error()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, closer, err := test.src.adapter()
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.Nil(t, err)
+			defer closer.Close()
+
+			enforcer, err := casbinV2.NewEnforcer(modelPath, a)
+			assert.Nil(t, err)
+			allowed, err := enforcer.Enforce("cathy", "/dataset1/x", "DELETE")
+			assert.Nil(t, err)
+			assert.True(t, allowed)
+		})
+	}
+}
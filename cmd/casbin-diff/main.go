@@ -0,0 +1,118 @@
+// Command casbin-diff compares two casbin policy CSV files section by section
+// and prints the rules to remove and to add, as a diff or as JSON.
+//
+//	casbin-diff -model authz_model.conf -from current.csv -to desired.csv [-format json] [-apply target.csv] [-dry-run]
+//
+// With -apply the changeset is applied incrementally to the target policy,
+// removals first, skipping the rules the target already has or misses;
+// -dry-run prints the changes which would be applied to the target instead of
+// the changeset. It exits with 1 when there are changes and nothing is
+// applied, and with 2 on errors.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	casbinV2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	fileAdapter "github.com/casbin/casbin/v2/persist/file-adapter"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policy"
+)
+
+func main() {
+	modelPath := flag.String("model", "", "path of the model CONF file")
+	fromPath := flag.String("from", "", "path of the current policy CSV file")
+	toPath := flag.String("to", "", "path of the desired policy CSV file")
+	format := flag.String("format", "text", "output format, text or json")
+	applyPath := flag.String("apply", "", "path of the policy CSV file to apply the changeset to")
+	dryRun := flag.Bool("dry-run", false, "print the changes to the -apply target without applying them")
+	flag.Parse()
+
+	if *modelPath == "" || *fromPath == "" || *toPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	m, err := model.NewModelFromFile(*modelPath)
+	if err != nil {
+		fatal("load model: %v", err)
+	}
+
+	from, err := policy.LoadFile(m, *fromPath)
+	if err != nil {
+		fatal("load %s: %v", *fromPath, err)
+	}
+	to, err := policy.LoadFile(m, *toPath)
+	if err != nil {
+		fatal("load %s: %v", *toPath, err)
+	}
+
+	changes := policy.Diff(from, to)
+
+	var target *casbinV2.Enforcer
+	if *applyPath != "" {
+		if target, err = openTarget(m, *applyPath); err != nil {
+			fatal("load %s: %v", *applyPath, err)
+		}
+		if *dryRun {
+			if changes, err = changes.Plan(policy.EnforcerTarget(target)); err != nil {
+				fatal("plan %s: %v", *applyPath, err)
+			}
+		}
+	}
+
+	switch *format {
+	case "json":
+		if changes == nil {
+			changes = policy.Changeset{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(changes)
+	case "text":
+		fmt.Print(changes)
+		added, removed := changes.Counts()
+		fmt.Fprintf(os.Stderr, "%d added, %d removed\n", added, removed)
+	default:
+		fatal("unknown format %q", *format)
+	}
+
+	if target == nil || *dryRun {
+		if !changes.Empty() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err = apply(target, changes); err != nil {
+		fatal("apply to %s: %v", *applyPath, err)
+	}
+}
+
+// openTarget loads the target policy into an enforcer without auto-save, as
+// the file adapter does not support incremental writes.
+func openTarget(m model.Model, path string) (*casbinV2.Enforcer, error) {
+	enforcer, err := casbinV2.NewEnforcer(m.Copy(), fileAdapter.NewAdapter(path))
+	if err != nil {
+		return nil, err
+	}
+	enforcer.EnableAutoSave(false)
+	return enforcer, nil
+}
+
+// apply applies the changeset through the enforcer and saves the result.
+func apply(enforcer *casbinV2.Enforcer, changes policy.Changeset) error {
+	if err := changes.Apply(policy.EnforcerTarget(enforcer)); err != nil {
+		return err
+	}
+	return enforcer.SavePolicy()
+}
+
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "casbin-diff: "+format+"\n", args...)
+	os.Exit(2)
+}
@@ -0,0 +1,99 @@
+// Command casbin-lint checks a casbin model and policy CSV for duplicate and
+// shadowed rules, role cycles, undefined roles, invalid effects and rules that
+// match no known operation.
+//
+//	casbin-lint -model authz_model.conf -policy authz_policy.csv [-operations operations.txt] [-format json] [-strict]
+//
+// It exits with 1 when errors are found, or warnings with -strict, and with 2
+// when the inputs cannot be loaded.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/lint"
+)
+
+func main() {
+	modelPath := flag.String("model", "", "path of the model CONF file")
+	policyPath := flag.String("policy", "", "path of the policy CSV file")
+	operationsPath := flag.String("operations", "", "path of a file listing the known operations, one per line")
+	format := flag.String("format", "text", "output format, text or json")
+	strict := flag.Bool("strict", false, "exit non-zero on warnings too")
+	flag.Parse()
+
+	if *modelPath == "" || *policyPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format != "text" && *format != "json" {
+		fatal("unknown format %q", *format)
+	}
+
+	m, err := model.NewModelFromFile(*modelPath)
+	if err != nil {
+		fatal("load model: %v", err)
+	}
+
+	rules, err := lint.LoadRules(*policyPath)
+	if err != nil {
+		fatal("load policy: %v", err)
+	}
+
+	var operations []string
+	if *operationsPath != "" {
+		if operations, err = loadOperations(*operationsPath); err != nil {
+			fatal("load operations: %v", err)
+		}
+	}
+
+	findings := lint.Lint(m, rules, operations)
+
+	switch *format {
+	case "json":
+		if findings == nil {
+			findings = []lint.Finding{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(findings)
+	default:
+		for _, f := range findings {
+			fmt.Printf("%s: %s\n", *policyPath, f)
+		}
+	}
+
+	if lint.HasErrors(findings) || (*strict && len(findings) > 0) {
+		os.Exit(1)
+	}
+}
+
+func loadOperations(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var operations []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			operations = append(operations, line)
+		}
+	}
+	return operations, scanner.Err()
+}
+
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "casbin-lint: "+format+"\n", args...)
+	os.Exit(2)
+}
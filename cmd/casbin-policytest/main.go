@@ -0,0 +1,89 @@
+// Command casbin-policytest checks YAML policy expectation files against their
+// model and policy.
+//
+//	casbin-policytest [-model authz_model.conf] [-policy authz_policy.csv] [-format json] [-v] suite.yaml...
+//
+// The model and policy flags override the paths declared in the suites. It
+// exits with 1 when a case fails and with 2 when a suite cannot be loaded.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tx7do/kratos-casbin/authz/casbin/policytest"
+)
+
+type suiteResult struct {
+	Suite   string              `json:"suite"`
+	Results []policytest.Result `json:"results"`
+}
+
+func main() {
+	modelPath := flag.String("model", "", "path of the model CONF file, overrides the suites")
+	policyPath := flag.String("policy", "", "path of the policy CSV file, overrides the suites")
+	format := flag.String("format", "text", "output format, text or json")
+	verbose := flag.Bool("v", false, "print passing cases too")
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*format != "text" && *format != "json") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		all    []suiteResult
+		failed int
+	)
+	for _, path := range flag.Args() {
+		suite, err := policytest.Load(path)
+		if err != nil {
+			fatal("%v", err)
+		}
+		if *modelPath != "" {
+			suite.Model = *modelPath
+		}
+		if *policyPath != "" {
+			suite.Policy = *policyPath
+		}
+
+		enforcer, err := suite.NewEnforcer()
+		if err != nil {
+			fatal("%s: %v", path, err)
+		}
+
+		results := suite.Run(enforcer)
+		failed += len(policytest.Failed(results))
+		all = append(all, suiteResult{Suite: path, Results: results})
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(all)
+	} else {
+		for _, sr := range all {
+			for _, r := range sr.Results {
+				if *verbose || !r.Passed {
+					fmt.Printf("%s: %s\n", sr.Suite, r)
+				}
+			}
+		}
+		if failed > 0 {
+			fmt.Printf("FAIL: %d case(s) failed\n", failed)
+		} else {
+			fmt.Println("PASS")
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "casbin-policytest: "+format+"\n", args...)
+	os.Exit(2)
+}